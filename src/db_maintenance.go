@@ -8,44 +8,59 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// CleanupOldData deletes log entries older than the specified retention period
-// This helps reduce database size by removing old statistics
-func CleanupOldData(dbPath string, retentionDays int) error {
-	db, err := sql.Open("sqlite", dbPath)
+// CleanupOldData deletes message pattern and exception statistics older than the retention period
+// (the log stat buckets are cleaned up by the stats backend)
+func CleanupOldData(db *sql.DB, retentionDays int) error {
+	cutoffDate := time.Now().AddDate(0, 0, -retentionDays).Format(time.RFC3339)
+
+	// Message pattern stats follow the same retention, patterns are kept while they are seen
+	result, err := db.Exec("DELETE FROM log_pattern_stats WHERE bucket_ts < ?", cutoffDate)
 	if err != nil {
-		log.Printf("    "+"Error opening database: %v\n", err)
+		log.Printf("    "+"Error cleaning up old pattern stats: %v\n", err)
 		return err
 	}
-	defer db.Close()
+	patternRows, _ := result.RowsAffected()
 
-	cutoffDate := time.Now().AddDate(0, 0, -retentionDays).Format(time.RFC3339)
+	result, err = db.Exec("DELETE FROM log_patterns WHERE last_seen_ts < ?", cutoffDate)
+	if err != nil {
+		log.Printf("    "+"Error cleaning up old patterns: %v\n", err)
+		return err
+	}
+	patterns, _ := result.RowsAffected()
+	log.Printf("    "+"Cleanup: deleted %d pattern stat rows and %d patterns\n", patternRows, patterns)
+
+	// Exception stats follow the same retention, fingerprints are kept while they are seen
+	result, err = db.Exec("DELETE FROM stack_trace_stats WHERE bucket_ts < ?", cutoffDate)
+	if err != nil {
+		log.Printf("    "+"Error cleaning up old exception stats: %v\n", err)
+		return err
+	}
+	exceptionRows, _ := result.RowsAffected()
 
-	result, err := db.Exec("DELETE FROM log_stats WHERE bucket_ts < ?", cutoffDate)
+	result, err = db.Exec("DELETE FROM stack_traces WHERE last_seen_ts < ?", cutoffDate)
 	if err != nil {
-		log.Printf("    "+"Error cleaning up old data: %v\n", err)
+		log.Printf("    "+"Error cleaning up old stack traces: %v\n", err)
 		return err
 	}
+	stackTraces, _ := result.RowsAffected()
 
-	rowsAffected, _ := result.RowsAffected()
-	log.Printf("    "+"Cleanup: deleted %d rows older than %d days\n", rowsAffected, retentionDays)
+	// Hosts go with their fingerprint, a fingerprint seen again starts over like its total count
+	if _, err := db.Exec("DELETE FROM stack_trace_hosts WHERE fingerprint NOT IN (SELECT fingerprint FROM stack_traces)"); err != nil {
+		log.Printf("    "+"Error cleaning up stack trace hosts: %v\n", err)
+		return err
+	}
+	log.Printf("    "+"Cleanup: deleted %d exception stat rows and %d stack traces\n", exceptionRows, stackTraces)
 
 	return nil
 }
 
 // VacuumDatabase reclaims unused space and optimizes the database file
 // Should be run periodically (e.g., after cleanup operations)
-func VacuumDatabase(dbPath string) error {
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		log.Printf("    "+"Error opening database: %v\n", err)
-		return err
-	}
-	defer db.Close()
-
+func VacuumDatabase(db *sql.DB) error {
 	log.Printf("    " + "Running VACUUM to reclaim disk space...\n")
 	start := time.Now()
 
-	_, err = db.Exec("VACUUM")
+	_, err := db.Exec("VACUUM")
 	if err != nil {
 		log.Printf("    "+"Error running VACUUM: %v\n", err)
 		return err
@@ -55,31 +70,20 @@ func VacuumDatabase(dbPath string) error {
 	return nil
 }
 
-// GetDatabaseStats returns statistics about the database
-func GetDatabaseStats(dbPath string) (map[string]interface{}, error) {
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
+// GetDatabaseStats returns statistics about the buckets of the given size in the stats backend and
+// about the database file
+func GetDatabaseStats(db *sql.DB, backend StatsBackend, bucketSize int) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
-	// Get total row count
-	var rowCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM log_stats").Scan(&rowCount)
+	// Row count, range and hosts from the backend
+	backendStats, err := backend.Stats(bucketSize)
 	if err != nil {
 		return nil, err
 	}
-	stats["total_rows"] = rowCount
-
-	// Get date range
-	var oldestBucket, newestBucket string
-	err = db.QueryRow("SELECT MIN(bucket_ts), MAX(bucket_ts) FROM log_stats").Scan(&oldestBucket, &newestBucket)
-	if err == nil {
-		stats["oldest_bucket"] = oldestBucket
-		stats["newest_bucket"] = newestBucket
-	}
+	stats["total_rows"] = backendStats.Rows
+	stats["oldest_bucket"] = backendStats.OldestBucket
+	stats["newest_bucket"] = backendStats.NewestBucket
+	stats["unique_hosts"] = backendStats.UniqueHosts
 
 	// Get database file size (page_count * page_size)
 	var pageCount, pageSize int
@@ -87,36 +91,46 @@ func GetDatabaseStats(dbPath string) (map[string]interface{}, error) {
 	db.QueryRow("PRAGMA page_size").Scan(&pageSize)
 	stats["db_size_mb"] = float64(pageCount*pageSize) / (1024 * 1024)
 
-	// Get number of unique hosts
-	var hostCount int
-	db.QueryRow("SELECT COUNT(DISTINCT hostname) FROM log_stats").Scan(&hostCount)
-	stats["unique_hosts"] = hostCount
-
 	return stats, nil
 }
 
-// RunMaintenance performs complete database maintenance including stats display, cleanup, and vacuum
-func RunMaintenance(dbPath string, retentionDays int) {
+// RunMaintenance performs complete database maintenance including stats display, rollups, cleanup, and vacuum
+func RunMaintenance(backend StatsBackend, db *sql.DB, resolutions []BucketResolution, tiers []RollupTier, searchRetentionDays int) {
 	log.Println("=== Running database maintenance ===")
+	primarySize := int(resolutions[0].Size.Seconds())
 
 	// Show current stats
-	if stats, err := GetDatabaseStats(dbPath); err == nil {
+	if stats, err := GetDatabaseStats(db, backend, primarySize); err == nil {
 		log.Printf("    "+"Before: %d rows, %.2f MB, %d hosts\n",
 			stats["total_rows"], stats["db_size_mb"], stats["unique_hosts"])
 	}
 
+	// Downsample into rollup tiers before full resolution data expires
+	if err := RollupStats(db, backend, finestResolution(resolutions), tiers); err != nil {
+		log.Printf("    "+"Rollup error: %v\n", err)
+	}
+
 	// Clean up old data
-	if err := CleanupOldData(dbPath, retentionDays); err != nil {
+	if err := backend.Cleanup(resolutions); err != nil {
 		log.Printf("    "+"Cleanup error: %v\n", err)
 	}
+	if err := CleanupOldData(db, resolutions[0].RetentionDays); err != nil {
+		log.Printf("    "+"Cleanup error: %v\n", err)
+	}
+	if err := CleanupRollups(db, tiers); err != nil {
+		log.Printf("    "+"Rollup cleanup error: %v\n", err)
+	}
+	if err := CleanupSearchIndex(db, searchRetentionDays); err != nil {
+		log.Printf("    "+"Search index cleanup error: %v\n", err)
+	}
 
 	// Reclaim disk space
-	if err := VacuumDatabase(dbPath); err != nil {
+	if err := VacuumDatabase(db); err != nil {
 		log.Printf("    "+"Vacuum error: %v\n", err)
 	}
 
 	// Show new stats
-	if stats, err := GetDatabaseStats(dbPath); err == nil {
+	if stats, err := GetDatabaseStats(db, backend, primarySize); err == nil {
 		log.Printf("    "+"After: %d rows, %.2f MB\n",
 			stats["total_rows"], stats["db_size_mb"])
 	}
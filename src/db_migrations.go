@@ -0,0 +1,387 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// migration is one schema change, applied in its own transaction in version order.
+// Migrations are never edited once released, schema changes are added as new versions.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx, env migrationEnv) error
+}
+
+// migrationEnv holds the configuration some migrations depend on
+type migrationEnv struct {
+	primaryBucketSizeS int // bucket size assigned to rows written before sizes were recorded
+}
+
+// migrations lists all schema versions. Early versions use CREATE ... IF NOT EXISTS so databases
+// created before versioning are adopted without changes.
+var migrations = []migration{
+	{1, "log_stats", migrateLogStats},
+	{2, "message patterns", migratePatternTables},
+	{3, "stack traces", migrateStackTraceTables},
+	{4, "rollup tables", migrateRollupTables},
+	{5, "bucket sizes", migrateBucketSizeColumn},
+	{6, "dimension tables", migrateDimensionTables},
+	{7, "message search", migrateMessageSearch},
+	{8, "stack trace hosts", migrateStackTraceHosts},
+}
+
+// migrateDB applies all migrations newer than the schema version of the database
+func migrateDB(db *sql.DB, env migrationEnv) (int, error) {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_ts TEXT NOT NULL
+	);`)
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := getSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Printf("=== Migrating database to version %d (%s) ===\n", m.version, m.name)
+		tx, err := db.Begin()
+		if err != nil {
+			return current, err
+		}
+		if err := m.up(tx, env); err != nil {
+			tx.Rollback()
+			return current, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_version (version, name, applied_ts) VALUES (?, ?, ?)",
+			m.version, m.name, time.Now().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return current, err
+		}
+		if err := tx.Commit(); err != nil {
+			return current, err
+		}
+		current = m.version
+	}
+
+	return current, nil
+}
+
+// getSchemaVersion returns the version of the last applied migration (0 = none)
+func getSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// migrateLogStats creates the original log_stats table
+func migrateLogStats(tx *sql.Tx, env migrationEnv) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS log_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hostname TEXT NOT NULL,
+		bucket_ts TEXT NOT NULL,
+		bucket_duration_s INTEGER NOT NULL,
+		level TEXT NOT NULL,
+		logger TEXT NOT NULL,
+		n INTEGER NOT NULL,
+		first_seen_ts TEXT NOT NULL DEFAULT '',
+		UNIQUE(hostname, bucket_ts, level, logger)
+	);
+	CREATE INDEX IF NOT EXISTS idx_bucket_ts ON log_stats(bucket_ts);`)
+	return err
+}
+
+// migratePatternTables creates the message pattern tables (filled if pattern mining is enabled)
+func migratePatternTables(tx *sql.Tx, env migrationEnv) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS log_patterns (
+		pattern_id TEXT PRIMARY KEY,
+		logger TEXT NOT NULL,
+		template TEXT NOT NULL,
+		total_count INTEGER NOT NULL,
+		first_seen_ts TEXT NOT NULL,
+		last_seen_ts TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS log_pattern_stats (
+		hostname TEXT NOT NULL,
+		bucket_ts TEXT NOT NULL,
+		level TEXT NOT NULL,
+		logger TEXT NOT NULL,
+		pattern_id TEXT NOT NULL,
+		n INTEGER NOT NULL,
+		first_seen_ts TEXT NOT NULL DEFAULT '',
+		UNIQUE(hostname, bucket_ts, level, logger, pattern_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_pattern_stats_bucket_ts ON log_pattern_stats(bucket_ts);
+	CREATE INDEX IF NOT EXISTS idx_pattern_stats_pattern_id ON log_pattern_stats(pattern_id);`)
+	return err
+}
+
+// migrateStackTraceTables creates the stack trace fingerprint tables
+func migrateStackTraceTables(tx *sql.Tx, env migrationEnv) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS stack_traces (
+		fingerprint TEXT PRIMARY KEY,
+		exception_class TEXT NOT NULL,
+		top_frames TEXT NOT NULL,
+		logger TEXT NOT NULL,
+		first_seen_ts TEXT NOT NULL,
+		last_seen_ts TEXT NOT NULL,
+		total_count INTEGER NOT NULL,
+		host_count INTEGER NOT NULL DEFAULT 0,
+		sample_trace TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS stack_trace_stats (
+		fingerprint TEXT NOT NULL,
+		hostname TEXT NOT NULL,
+		logger TEXT NOT NULL,
+		level TEXT NOT NULL,
+		bucket_ts TEXT NOT NULL,
+		n INTEGER NOT NULL,
+		UNIQUE(fingerprint, hostname, logger, level, bucket_ts)
+	);
+	CREATE INDEX IF NOT EXISTS idx_stack_trace_stats_bucket_ts ON stack_trace_stats(bucket_ts);`)
+	return err
+}
+
+// migrateRollupTables creates the rollup tables of all tiers and the watermark table
+func migrateRollupTables(tx *sql.Tx, env migrationEnv) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS rollup_state (
+		table_name TEXT PRIMARY KEY,
+		rolled_until TEXT NOT NULL
+	);`)
+	if err != nil {
+		return err
+	}
+
+	for _, tier := range DefaultRollupTiers(0, 0) {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + tier.Table + ` (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hostname TEXT NOT NULL,
+			bucket_ts TEXT NOT NULL,
+			bucket_duration_s INTEGER NOT NULL,
+			level TEXT NOT NULL,
+			logger TEXT NOT NULL,
+			n INTEGER NOT NULL,
+			first_seen_ts TEXT NOT NULL DEFAULT '',
+			UNIQUE(hostname, bucket_ts, level, logger)
+		);
+		CREATE INDEX IF NOT EXISTS idx_` + tier.Table + `_bucket_ts ON ` + tier.Table + `(bucket_ts);`)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateBucketSizeColumn rebuilds log_stats with bucket_size_s (the unique constraint changes).
+// Existing rows get their full bucket duration as size, partial buckets the primary bucket size.
+func migrateBucketSizeColumn(tx *sql.Tx, env migrationEnv) error {
+	hasColumn, err := hasTableColumn(tx, "log_stats", "bucket_size_s")
+	if err != nil {
+		return err
+	}
+
+	if !hasColumn {
+		validSizes := ""
+		for size := range validBucketSizes {
+			if validSizes != "" {
+				validSizes += ", "
+			}
+			validSizes += fmt.Sprint(int(size.Seconds()))
+		}
+
+		statements := []string{
+			"DROP INDEX IF EXISTS idx_bucket_ts",
+			"ALTER TABLE log_stats RENAME TO log_stats_old",
+			`CREATE TABLE log_stats (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				hostname TEXT NOT NULL,
+				bucket_ts TEXT NOT NULL,
+				bucket_duration_s INTEGER NOT NULL,
+				bucket_size_s INTEGER NOT NULL,
+				level TEXT NOT NULL,
+				logger TEXT NOT NULL,
+				n INTEGER NOT NULL,
+				first_seen_ts TEXT NOT NULL DEFAULT '',
+				UNIQUE(bucket_size_s, hostname, bucket_ts, level, logger)
+			)`,
+			fmt.Sprintf(`
+			INSERT INTO log_stats (hostname, bucket_ts, bucket_duration_s, bucket_size_s, level, logger, n, first_seen_ts)
+			SELECT hostname, bucket_ts, bucket_duration_s,
+				CASE WHEN bucket_duration_s IN (%s) THEN bucket_duration_s ELSE %d END,
+				level, logger, n, first_seen_ts
+			FROM log_stats_old`, validSizes, env.primaryBucketSizeS),
+			"DROP TABLE log_stats_old",
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_bucket_ts ON log_stats(bucket_ts);
+	CREATE INDEX IF NOT EXISTS idx_bucket_size_ts ON log_stats(bucket_size_s, bucket_ts);`)
+	return err
+}
+
+// migrateDimensionTables moves host, level and logger names of log_stats into dimension tables with
+// catalog metadata. log_stats is rebuilt with foreign keys, log_stats_named resolves the names.
+// Catalog totals count the primary bucket size only.
+func migrateDimensionTables(tx *sql.Tx, env migrationEnv) error {
+	for _, dimension := range catalogDimensionNames {
+		_, err := tx.Exec(`
+		CREATE TABLE ` + dimension + ` (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			first_seen_ts TEXT NOT NULL DEFAULT '',
+			last_seen_ts TEXT NOT NULL DEFAULT '',
+			total_count INTEGER NOT NULL DEFAULT 0,
+			notes TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT ''
+		)`)
+		if err != nil {
+			return err
+		}
+	}
+
+	statements := []string{
+		"DROP INDEX IF EXISTS idx_bucket_ts",
+		"DROP INDEX IF EXISTS idx_bucket_size_ts",
+		"ALTER TABLE log_stats RENAME TO log_stats_old",
+		fmt.Sprintf(`
+		INSERT INTO hosts (name, first_seen_ts, last_seen_ts, total_count)
+		SELECT hostname, MIN(CASE WHEN first_seen_ts = '' THEN bucket_ts ELSE first_seen_ts END), MAX(bucket_ts),
+			SUM(CASE WHEN bucket_size_s = %d THEN n ELSE 0 END)
+		FROM log_stats_old GROUP BY hostname`, env.primaryBucketSizeS),
+		fmt.Sprintf(`
+		INSERT INTO levels (name, first_seen_ts, last_seen_ts, total_count)
+		SELECT level, MIN(CASE WHEN first_seen_ts = '' THEN bucket_ts ELSE first_seen_ts END), MAX(bucket_ts),
+			SUM(CASE WHEN bucket_size_s = %d THEN n ELSE 0 END)
+		FROM log_stats_old GROUP BY level`, env.primaryBucketSizeS),
+		fmt.Sprintf(`
+		INSERT INTO loggers (name, first_seen_ts, last_seen_ts, total_count)
+		SELECT logger, MIN(CASE WHEN first_seen_ts = '' THEN bucket_ts ELSE first_seen_ts END), MAX(bucket_ts),
+			SUM(CASE WHEN bucket_size_s = %d THEN n ELSE 0 END)
+		FROM log_stats_old GROUP BY logger`, env.primaryBucketSizeS),
+		`CREATE TABLE log_stats (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			host_id INTEGER NOT NULL REFERENCES hosts(id),
+			bucket_ts TEXT NOT NULL,
+			bucket_duration_s INTEGER NOT NULL,
+			bucket_size_s INTEGER NOT NULL,
+			level_id INTEGER NOT NULL REFERENCES levels(id),
+			logger_id INTEGER NOT NULL REFERENCES loggers(id),
+			n INTEGER NOT NULL,
+			first_seen_ts TEXT NOT NULL DEFAULT '',
+			UNIQUE(bucket_size_s, host_id, bucket_ts, level_id, logger_id)
+		)`,
+		`INSERT INTO log_stats (host_id, bucket_ts, bucket_duration_s, bucket_size_s, level_id, logger_id, n, first_seen_ts)
+		SELECT h.id, o.bucket_ts, o.bucket_duration_s, o.bucket_size_s, l.id, g.id, o.n, o.first_seen_ts
+		FROM log_stats_old o
+		JOIN hosts h ON h.name = o.hostname
+		JOIN levels l ON l.name = o.level
+		JOIN loggers g ON g.name = o.logger`,
+		"DROP TABLE log_stats_old",
+		"CREATE INDEX idx_bucket_ts ON log_stats(bucket_ts)",
+		"CREATE INDEX idx_bucket_size_ts ON log_stats(bucket_size_s, bucket_ts)",
+		"CREATE INDEX idx_log_stats_logger_id ON log_stats(logger_id)",
+		`CREATE VIEW log_stats_named AS
+		SELECT s.id, h.name AS hostname, s.bucket_ts, s.bucket_duration_s, s.bucket_size_s, l.name AS level, g.name AS logger, s.n, s.first_seen_ts
+		FROM log_stats s
+		JOIN hosts h ON h.id = s.host_id
+		JOIN levels l ON l.id = s.level_id
+		JOIN loggers g ON g.id = s.logger_id`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateMessageSearch creates the full-text index of selected messages. search_fts holds the text,
+// its rowid is the id of the search_messages row with time and dimensions.
+func migrateMessageSearch(tx *sql.Tx, env migrationEnv) error {
+	statements := []string{
+		`CREATE TABLE search_messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ts_ms INTEGER NOT NULL,
+			host_id INTEGER NOT NULL REFERENCES hosts(id),
+			level_id INTEGER NOT NULL REFERENCES levels(id),
+			logger_id INTEGER NOT NULL REFERENCES loggers(id)
+		)`,
+		"CREATE INDEX idx_search_messages_ts ON search_messages(ts_ms)",
+		"CREATE VIRTUAL TABLE search_fts USING fts5(message, stack_trace)",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateStackTraceHosts creates the hosts of each fingerprint, kept while the fingerprint is kept (not
+// pruned with the exception stats), from the exception stats still present
+func migrateStackTraceHosts(tx *sql.Tx, env migrationEnv) error {
+	statements := []string{
+		`CREATE TABLE stack_trace_hosts (
+			fingerprint TEXT NOT NULL,
+			hostname TEXT NOT NULL,
+			PRIMARY KEY (fingerprint, hostname)
+		) WITHOUT ROWID`,
+		"INSERT OR IGNORE INTO stack_trace_hosts (fingerprint, hostname) SELECT DISTINCT fingerprint, hostname FROM stack_trace_stats",
+		// Host counts already reduced by pruned stats are kept as they are
+		"UPDATE stack_traces SET host_count = MAX(host_count, (SELECT COUNT(*) FROM stack_trace_hosts h WHERE h.fingerprint = stack_traces.fingerprint))",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasTableColumn reports whether a table has the given column
+func hasTableColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			found = true
+		}
+	}
+	return found, rows.Err()
+}
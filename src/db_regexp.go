@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+
+	sqlite "modernc.org/sqlite"
+)
+
+// regexpCacheSize limits the compiled patterns kept for the REGEXP function
+const regexpCacheSize = 256
+
+// regexpCache holds the patterns compiled by the REGEXP function, a query calls it once per row
+var regexpCache = struct {
+	patterns map[string]*regexp.Regexp
+	mu       sync.Mutex
+}{patterns: make(map[string]*regexp.Regexp)}
+
+func init() {
+	// "X REGEXP Y" calls regexp(Y, X), so queries match with the same Go regex syntax as in memory
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, sqliteRegexp)
+}
+
+// sqliteRegexp implements the REGEXP operator: 1 if the value matches the pattern, NULL for NULL values
+func sqliteRegexp(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	pattern, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("regexp: pattern must be text")
+	}
+
+	var value string
+	switch v := args[1].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+
+	re, err := cachedRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.MatchString(value) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+// cachedRegexp returns the compiled pattern, the cache is reset when full
+func cachedRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.mu.Lock()
+	defer regexpCache.mu.Unlock()
+
+	if re, exists := regexpCache.patterns[pattern]; exists {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexpCache.patterns) >= regexpCacheSize {
+		regexpCache.patterns = make(map[string]*regexp.Regexp)
+	}
+	regexpCache.patterns[pattern] = re
+	return re, nil
+}
+
+// regexCondition returns the SQL condition (starting with " AND") matching a column against a regex.
+// The literal prefix of an anchored regex is checked with LIKE first, so most rows are rejected without
+// calling the REGEXP function.
+func regexCondition(column, pattern string) (string, []interface{}) {
+	if prefix := regexLiteralPrefix(pattern); prefix != "" {
+		return " AND " + column + " LIKE ? ESCAPE '\\' AND " + column + " REGEXP ?", []interface{}{escapeLike(prefix) + "%", pattern}
+	}
+	return " AND " + column + " REGEXP ?", []interface{}{pattern}
+}
+
+// regexLiteralPrefix returns the literal text every match of a regex anchored with ^ starts with
+// ("" if the regex is not anchored, has no literal prefix or is case-insensitive). Alternatives that
+// are all anchored share their common prefix.
+func regexLiteralPrefix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	return string(anchoredLiteralPrefix(re.Simplify()))
+}
+
+// anchoredLiteralPrefix returns the literal prefix of a parsed regex anchored with ^
+func anchoredLiteralPrefix(re *syntax.Regexp) []rune {
+	if re.Op == syntax.OpAlternate {
+		common := anchoredLiteralPrefix(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			prefix := anchoredLiteralPrefix(sub)
+			n := 0
+			for n < len(common) && n < len(prefix) && common[n] == prefix[n] {
+				n++
+			}
+			common = common[:n]
+		}
+		return common
+	}
+
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 {
+		return nil
+	}
+	if re.Sub[0].Op != syntax.OpBeginText || re.Sub[1].Op != syntax.OpLiteral || re.Sub[1].Flags&syntax.FoldCase != 0 {
+		return nil
+	}
+	return re.Sub[1].Rune
+}
+
+// escapeLike escapes the LIKE wildcards of a literal (used with ESCAPE '\')
+func escapeLike(literal string) string {
+	literal = strings.ReplaceAll(literal, "\\", "\\\\")
+	literal = strings.ReplaceAll(literal, "%", "\\%")
+	return strings.ReplaceAll(literal, "_", "\\_")
+}
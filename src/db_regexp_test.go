@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegexLiteralPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`^org\.example\.`, "org.example."},
+		{`^org\.example\..*Service$`, "org.example."},
+		{`^abc`, "abc"},
+		{`^a`, "a"},
+		{`^ab+`, "a"},
+		{`^abc?`, "ab"},
+		{`^a.b`, "a"},
+		{`^100%_done`, "100%_done"},
+		{`^ünï`, "ünï"},
+		{`org\.example`, ""},
+		{`.*^abc`, ""},
+		{`^`, ""},
+		{`^.*abc`, ""},
+		{`^[ab]c`, ""},
+		{`^(abc)`, ""},
+		{`(?m)^abc`, ""},
+		{`\Aabc`, "abc"},
+		// case-insensitive
+		{`(?i)^abc`, ""},
+		{`^(?i)abc`, ""},
+		{`^(?i:a)bc`, ""},
+		{`^abc(?i)def`, "abc"},
+		// alternation
+		{`^abc|^abd`, "ab"},
+		{`^abc|^abcd`, "abc"},
+		{`^a|^b`, ""},
+		{`^abc|def`, ""},
+		{`abc|^def`, ""},
+		{`^(?:abc|abd)`, "ab"},
+		{`^(?:abc|xyz)`, ""},
+		// invalid
+		{`^abc(`, ""},
+		{`^[`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := regexLiteralPrefix(tt.pattern); got != tt.want {
+				t.Errorf("regexLiteralPrefix(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexCondition(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		condition string
+		args      []interface{}
+	}{
+		{`^org\.example\.`, ` AND logger LIKE ? ESCAPE '\' AND logger REGEXP ?`, []interface{}{`org.example.%`, `^org\.example\.`}},
+		{`^a_b%c\\d`, ` AND logger LIKE ? ESCAPE '\' AND logger REGEXP ?`, []interface{}{`a\_b\%c\\d%`, `^a_b%c\\d`}},
+		{`(?i)^org\.example`, ` AND logger REGEXP ?`, []interface{}{`(?i)^org\.example`}},
+		{`^org|^com`, ` AND logger REGEXP ?`, []interface{}{`^org|^com`}},
+		{`Service$`, ` AND logger REGEXP ?`, []interface{}{`Service$`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			condition, args := regexCondition("logger", tt.pattern)
+			if condition != tt.condition {
+				t.Errorf("condition = %q, want %q", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %q, want %q", args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// RollupTier is a downsampled copy of log_stats with its own retention.
+// Each tier is computed from the next finer tier (the first one from the stats backend).
+type RollupTier struct {
+	Name          string        `json:"name"`
+	Table         string        `json:"table"`
+	BucketSize    time.Duration `json:"-"`
+	RetentionDays int           `json:"retention_days"`
+	Lookback      time.Duration `json:"-"` // already rolled up buckets recomputed on each run (late data)
+}
+
+// DefaultRollupTiers returns the hourly and daily rollup tiers
+func DefaultRollupTiers(hourlyRetentionDays, dailyRetentionDays int) []RollupTier {
+	return []RollupTier{
+		{Name: "hourly", Table: "log_stats_hourly", BucketSize: time.Hour, RetentionDays: hourlyRetentionDays, Lookback: 24 * time.Hour},
+		{Name: "daily", Table: "log_stats_daily", BucketSize: 24 * time.Hour, RetentionDays: dailyRetentionDays, Lookback: 48 * time.Hour},
+	}
+}
+
+// getRollupWatermarks returns the end (exclusive) of the rolled up range per rollup table
+func getRollupWatermarks(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT table_name, rolled_until FROM rollup_state")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watermarks := make(map[string]string)
+	for rows.Next() {
+		var table, until string
+		if err := rows.Scan(&table, &until); err != nil {
+			return nil, err
+		}
+		watermarks[table] = until
+	}
+	return watermarks, rows.Err()
+}
+
+// RollupStats downsamples the buckets of the source resolution (read from the stats backend) into the rollup tiers.
+// Buckets within the lookback of a tier are recomputed so late arrivals flushed after the previous run are included.
+func RollupStats(db *sql.DB, backend StatsBackend, source BucketResolution, tiers []RollupTier) error {
+	watermarks, err := getRollupWatermarks(db)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sourceSize := int(source.Size.Seconds())
+	readSource := backend.QueryStats
+	oldestSource := func() string {
+		stats, err := backend.Stats(sourceSize)
+		if err != nil {
+			return ""
+		}
+		return stats.OldestBucket
+	}
+	sourceRetention := source.RetentionDays
+	sourceUntil := now
+
+	for _, tier := range tiers {
+		until := getBucketTime(sourceUntil, tier.BucketSize)
+
+		var from time.Time
+		if wm, err := time.Parse(time.RFC3339, watermarks[tier.Table]); err == nil {
+			from = wm.Add(-tier.Lookback)
+		} else {
+			// First run: roll up everything available in the source
+			from, _ = time.Parse(time.RFC3339, oldestSource())
+		}
+
+		// Never recompute from a source range that was already cleaned up
+		if cutoff := now.AddDate(0, 0, -sourceRetention); from.Before(cutoff) {
+			from = cutoff
+		}
+		from = getBucketTime(from.Local(), tier.BucketSize)
+
+		if from.Before(until) {
+			stats, err := readSource(StatsQuery{BucketSize: sourceSize, From: from.Format(time.RFC3339), Before: until.Format(time.RFC3339)})
+			if err != nil {
+				log.Printf("    "+"Error reading rollup source of %s: %v\n", tier.Table, err)
+				return err
+			}
+			n, err := rollupRange(db, tier, stats, until)
+			if err != nil {
+				log.Printf("    "+"Error rolling up %s: %v\n", tier.Table, err)
+				return err
+			}
+			log.Printf("    "+"Rollup %s: %d rows for %s - %s\n", tier.Name, n, from.Format(time.RFC3339), until.Format(time.RFC3339))
+		}
+
+		// The next tier is computed from this one
+		sourceTable := tier.Table
+		sourceSize = 0
+		readSource = func(q StatsQuery) ([]*LogStat, error) {
+			return queryStatsTable(db, sourceTable, q)
+		}
+		oldestSource = func() string {
+			var oldest sql.NullString
+			db.QueryRow("SELECT MIN(bucket_ts) FROM " + sourceTable).Scan(&oldest)
+			return oldest.String
+		}
+		sourceRetention = tier.RetentionDays
+		sourceUntil = until
+	}
+
+	return nil
+}
+
+// rollupRange aggregates the source stats into the tier buckets, replacing existing rows, and advances the watermark of the tier
+func rollupRange(db *sql.DB, tier RollupTier, stats []*LogStat, until time.Time) (int, error) {
+	untilTS := until.Format(time.RFC3339)
+
+	rolledUp := rebucketStats(stats, tier.BucketSize)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	upsertSQL := `
+	INSERT INTO ` + tier.Table + ` (hostname, bucket_ts, bucket_duration_s, level, logger, n, first_seen_ts)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(hostname, bucket_ts, level, logger)
+	DO UPDATE SET
+		n = excluded.n,
+		bucket_duration_s = excluded.bucket_duration_s,
+		first_seen_ts = excluded.first_seen_ts;
+	`
+	stmt, err := tx.Prepare(upsertSQL)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, stat := range rolledUp {
+		if _, err := stmt.Exec(stat.HostName, stat.BucketTS, stat.BucketDuration_S, stat.Level, stat.Logger, stat.N, stat.FirstSeenTS); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO rollup_state (table_name, rolled_until) VALUES (?, ?)
+	ON CONFLICT(table_name) DO UPDATE SET rolled_until = MAX(rollup_state.rolled_until, excluded.rolled_until);`, tier.Table, untilTS)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return len(rolledUp), tx.Commit()
+}
+
+// rebucketStats merges stats into buckets of the given size (aligned like getBucketTime)
+func rebucketStats(stats []*LogStat, bucketSize time.Duration) []*LogStat {
+	merged := make(map[string]*LogStat)
+	var result []*LogStat
+
+	for _, stat := range stats {
+		bucketTime, err := time.Parse(time.RFC3339, stat.BucketTS)
+		if err != nil {
+			continue
+		}
+		bucketTS := getBucketTime(bucketTime.Local(), bucketSize).Format(time.RFC3339)
+
+		key := stat.HostName + ":" + stat.Logger + ":" + stat.Level + ":" + bucketTS
+		if existing, exists := merged[key]; exists {
+			existing.N += stat.N
+			if stat.FirstSeenTS != "" && (existing.FirstSeenTS == "" || stat.FirstSeenTS < existing.FirstSeenTS) {
+				existing.FirstSeenTS = stat.FirstSeenTS
+			}
+			continue
+		}
+
+		rebucketed := &LogStat{
+			ID:               stat.ID,
+			HostName:         stat.HostName,
+			BucketTS:         bucketTS,
+			BucketDuration_S: int(bucketSize.Seconds()),
+			Level:            stat.Level,
+			Logger:           stat.Logger,
+			N:                stat.N,
+			FirstSeenTS:      stat.FirstSeenTS,
+		}
+		merged[key] = rebucketed
+		result = append(result, rebucketed)
+	}
+
+	return result
+}
+
+// CleanupRollups deletes rollup rows older than the retention of their tier
+func CleanupRollups(db *sql.DB, tiers []RollupTier) error {
+	for _, tier := range tiers {
+		cutoffDate := time.Now().AddDate(0, 0, -tier.RetentionDays).Format(time.RFC3339)
+
+		result, err := db.Exec("DELETE FROM "+tier.Table+" WHERE bucket_ts < ?", cutoffDate)
+		if err != nil {
+			log.Printf("    "+"Error cleaning up %s: %v\n", tier.Table, err)
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		log.Printf("    "+"Cleanup: deleted %d %s rows older than %d days\n", rowsAffected, tier.Name, tier.RetentionDays)
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// catalogDimensionNames lists the dimension tables (also the catalog names of the API)
+var catalogDimensionNames = []string{"hosts", "levels", "loggers"}
+
+// catalogDimensionValue returns the dimension value of a bucket
+func catalogDimensionValue(dimension string, stat *LogStat) string {
+	switch dimension {
+	case "hosts":
+		return stat.HostName
+	case "levels":
+		return stat.Level
+	default:
+		return stat.Logger
+	}
+}
+
+// validCatalogDimension reports whether the dimension has a catalog
+func validCatalogDimension(dimension string) bool {
+	for _, name := range catalogDimensionNames {
+		if name == dimension {
+			return true
+		}
+	}
+	return false
+}
+
+// CatalogEntry is a row of a dimension table with its metadata. Totals count the primary bucket size.
+type CatalogEntry struct {
+	ID          int64    `json:"id"` // 0 = not yet flushed
+	Name        string   `json:"name"`
+	FirstSeenTS string   `json:"first_seen_ts"`
+	LastSeenTS  string   `json:"last_seen_ts"` // start of the newest bucket with messages
+	TotalCount  int64    `json:"total_count"`
+	Notes       string   `json:"notes"`
+	Tags        []string `json:"tags"`
+}
+
+// dimensionCache maps dimension names to their IDs. IDs are only cached after the transaction
+// that resolved them committed, so rolled back inserts are never referenced.
+type dimensionCache struct {
+	ids map[string]map[string]int64 // dimension -> name -> id
+	mu  sync.Mutex
+}
+
+func newDimensionCache() *dimensionCache {
+	cache := &dimensionCache{ids: make(map[string]map[string]int64)}
+	for _, dimension := range catalogDimensionNames {
+		cache.ids[dimension] = make(map[string]int64)
+	}
+	return cache
+}
+
+// resolve returns the ID of a dimension value, inserting it within the transaction if it is new.
+// Newly resolved IDs are collected in pending and added to the cache with commit.
+func (c *dimensionCache) resolve(tx *sql.Tx, dimension, name string, pending map[string]map[string]int64) (int64, error) {
+	c.mu.Lock()
+	id, cached := c.ids[dimension][name]
+	c.mu.Unlock()
+	if cached {
+		return id, nil
+	}
+	if id, exists := pending[dimension][name]; exists {
+		return id, nil
+	}
+
+	if _, err := tx.Exec("INSERT INTO "+dimension+" (name) VALUES (?) ON CONFLICT(name) DO NOTHING", name); err != nil {
+		return 0, err
+	}
+	if err := tx.QueryRow("SELECT id FROM "+dimension+" WHERE name = ?", name).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if pending[dimension] == nil {
+		pending[dimension] = make(map[string]int64)
+	}
+	pending[dimension][name] = id
+	return id, nil
+}
+
+// commit adds the IDs resolved by a committed transaction to the cache
+func (c *dimensionCache) commit(pending map[string]map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for dimension, ids := range pending {
+		for name, id := range ids {
+			c.ids[dimension][name] = id
+		}
+	}
+}
+
+// flushCatalog updates first seen, last seen and total count of the dimension values of a flush batch
+// (and of earlier batches whose catalog update failed) within the flush transaction. The buckets are
+// already in the stats backend at this point: the first error is returned, so the transaction rolls
+// back, and the totals of a batch that finally fails are merged back and written with the next flush.
+func (s *LogStatStore) flushCatalog(tx *sql.Tx, batch *flushBatch) error {
+	primarySize := int(s.bucketSize.Seconds())
+
+	for _, dimension := range catalogDimensionNames {
+		entries := make(map[string]*CatalogEntry)
+		for _, stat := range catalogStats(batch.entries, batch.catalogEntries) {
+			if stat.BucketSize_S != primarySize {
+				continue
+			}
+			name := catalogDimensionValue(dimension, stat)
+			firstSeen := stat.FirstSeenTS
+			if firstSeen == "" {
+				firstSeen = stat.BucketTS
+			}
+
+			if entry, exists := entries[name]; exists {
+				entry.TotalCount += int64(stat.N)
+				if firstSeen < entry.FirstSeenTS {
+					entry.FirstSeenTS = firstSeen
+				}
+				if stat.BucketTS > entry.LastSeenTS {
+					entry.LastSeenTS = stat.BucketTS
+				}
+			} else {
+				entries[name] = &CatalogEntry{Name: name, FirstSeenTS: firstSeen, LastSeenTS: stat.BucketTS, TotalCount: int64(stat.N)}
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		stmt, err := tx.Prepare(`
+		INSERT INTO ` + dimension + ` (name, first_seen_ts, last_seen_ts, total_count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(name)
+		DO UPDATE SET
+			total_count = ` + dimension + `.total_count + excluded.total_count,
+			first_seen_ts = CASE
+				WHEN ` + dimension + `.first_seen_ts = '' OR excluded.first_seen_ts < ` + dimension + `.first_seen_ts THEN excluded.first_seen_ts
+				ELSE ` + dimension + `.first_seen_ts
+			END,
+			last_seen_ts = MAX(` + dimension + `.last_seen_ts, excluded.last_seen_ts);
+		`)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if _, err := stmt.Exec(entry.Name, entry.FirstSeenTS, entry.LastSeenTS, entry.TotalCount); err != nil {
+				stmt.Close()
+				return fmt.Errorf("upserting %s catalog entry %q: %w", dimension, entry.Name, err)
+			}
+		}
+		stmt.Close()
+	}
+
+	return nil
+}
+
+// catalogStats returns the buckets of the given maps
+func catalogStats(maps ...map[string]*LogStat) []*LogStat {
+	var stats []*LogStat
+	for _, entries := range maps {
+		for _, stat := range entries {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+// QueryCatalog returns the entries of a dimension catalog, most frequent first. Counts not yet flushed
+// are included, values seen only since the last flush are listed with ID 0.
+func (s *LogStatStore) QueryCatalog(dimension, nameRegex, tag string, maxResults int) ([]*CatalogEntry, error) {
+	if !validCatalogDimension(dimension) {
+		return nil, fmt.Errorf("unknown catalog %q (allowed: %s)", dimension, strings.Join(catalogDimensionNames, ", "))
+	}
+	regex, err := compileLoggerRegex(nameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, name, first_seen_ts, last_seen_ts, total_count, notes, tags FROM " + dimension + " WHERE 1=1"
+	var args []interface{}
+
+	if nameRegex != "" {
+		condition, regexArgs := regexCondition("name", nameRegex)
+		query += condition
+		args = append(args, regexArgs...)
+	}
+	if tag != "" {
+		query += " AND (',' || tags || ',') LIKE ?"
+		args = append(args, "%,"+tag+",%")
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entryMap := make(map[string]*CatalogEntry)
+	for rows.Next() {
+		entry, err := scanCatalogEntry(rows)
+		if err != nil {
+			log.Printf("Error scanning catalog row: %v\n", err)
+			continue
+		}
+		entryMap[entry.Name] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Add counts since the last flush
+	s.addPendingCatalogCounts(dimension, regex, tag == "", entryMap)
+
+	results := make([]*CatalogEntry, 0, len(entryMap))
+	for _, entry := range entryMap {
+		results = append(results, entry)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].TotalCount != results[j].TotalCount {
+			return results[i].TotalCount > results[j].TotalCount
+		}
+		return results[i].Name < results[j].Name
+	})
+
+	if maxResults > 0 && len(results) > maxResults {
+		results = results[:maxResults]
+	}
+
+	return results, nil
+}
+
+// addPendingCatalogCounts adds the in-memory buckets of the primary bucket size to catalog entries
+func (s *LogStatStore) addPendingCatalogCounts(dimension string, regex *regexp.Regexp, addNew bool, entryMap map[string]*CatalogEntry) {
+	primarySize := int(s.bucketSize.Seconds())
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Catalog totals are updated by the flush transaction, a batch being flushed counts until it commits
+	pending := []map[string]*LogStat{s.entries, s.catalogEntries}
+	if s.flushInFlight != nil {
+		pending = append(pending, s.flushInFlight.entries, s.flushInFlight.catalogEntries)
+	}
+
+	for _, entries := range pending {
+		for _, stat := range entries {
+			if stat.BucketSize_S != primarySize {
+				continue
+			}
+			name := catalogDimensionValue(dimension, stat)
+			if regex != nil && !regex.MatchString(name) {
+				continue
+			}
+
+			entry, exists := entryMap[name]
+			if !exists {
+				if !addNew {
+					continue
+				}
+				entry = &CatalogEntry{Name: name, Tags: []string{}}
+				entryMap[name] = entry
+			}
+			entry.TotalCount += int64(stat.N)
+			if stat.FirstSeenTS != "" && (entry.FirstSeenTS == "" || stat.FirstSeenTS < entry.FirstSeenTS) {
+				entry.FirstSeenTS = stat.FirstSeenTS
+			}
+			if stat.BucketTS > entry.LastSeenTS {
+				entry.LastSeenTS = stat.BucketTS
+			}
+		}
+	}
+}
+
+// GetCatalogEntry returns one entry of a dimension catalog (flushed counts only)
+func (s *LogStatStore) GetCatalogEntry(dimension string, id int64) (*CatalogEntry, error) {
+	if !validCatalogDimension(dimension) {
+		return nil, fmt.Errorf("unknown catalog %q (allowed: %s)", dimension, strings.Join(catalogDimensionNames, ", "))
+	}
+
+	row := s.db.QueryRow("SELECT id, name, first_seen_ts, last_seen_ts, total_count, notes, tags FROM "+dimension+" WHERE id = ?", id)
+	return scanCatalogEntry(row)
+}
+
+// UpdateCatalogEntry sets the user notes and tags of a catalog entry
+func (s *LogStatStore) UpdateCatalogEntry(dimension string, id int64, notes string, tags []string) (*CatalogEntry, error) {
+	if !validCatalogDimension(dimension) {
+		return nil, fmt.Errorf("unknown catalog %q (allowed: %s)", dimension, strings.Join(catalogDimensionNames, ", "))
+	}
+	tags, err := normalizeCatalogTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec("UPDATE "+dimension+" SET notes = ?, tags = ? WHERE id = ?", notes, strings.Join(tags, ","), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.GetCatalogEntry(dimension, id)
+}
+
+// normalizeCatalogTags trims, deduplicates and sorts tags. Tags are stored comma separated.
+func normalizeCatalogTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("invalid tag %q: tags must not contain commas", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCatalogEntry scans a dimension table row
+func scanCatalogEntry(row rowScanner) (*CatalogEntry, error) {
+	entry := &CatalogEntry{Tags: []string{}}
+	var tags string
+	if err := row.Scan(&entry.ID, &entry.Name, &entry.FirstSeenTS, &entry.LastSeenTS, &entry.TotalCount, &entry.Notes, &tags); err != nil {
+		return nil, err
+	}
+	if tags != "" {
+		entry.Tags = strings.Split(tags, ",")
+	}
+	return entry, nil
+}
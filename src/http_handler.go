@@ -1,13 +1,16 @@
 package main
 
 import (
+	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -84,10 +87,105 @@ func filterStatsByTimestamp(stats []*LogStat, minTS, maxTS string) []*LogStat {
 	return filtered
 }
 
+// parseQueryFilter reads the common query filter parameters and returns them for request logging
+func parseQueryFilter(c *fiber.Ctx) (QueryFilter, map[string]string) {
+	filter := QueryFilter{
+		Level:         c.Query("level"),
+		LoggerRegex:   c.Query("logger_regex"),
+		PatternID:     c.Query("pattern_id"),
+		Resolution:    c.Query("bucket"),
+		IncludeMemory: c.QueryBool("include_memory", true),
+		IncludeDB:     c.QueryBool("include_db", true),
+	}
+
+	params := map[string]string{
+		"level":          c.Query("level"),
+		"logger_regex":   c.Query("logger_regex"),
+		"start_time":     c.Query("start_time"),
+		"end_time":       c.Query("end_time"),
+		"max_results":    c.Query("max_results"),
+		"include_memory": fmt.Sprintf("%v", filter.IncludeMemory),
+		"include_db":     fmt.Sprintf("%v", filter.IncludeDB),
+	}
+	if filter.PatternID != "" {
+		params["pattern_id"] = filter.PatternID
+	}
+	if filter.Resolution != "" {
+		params["bucket"] = filter.Resolution
+	}
+
+	// Multi-value and exclusion filters (comma-separated lists), a single level keeps the exact level filter
+	if levels := splitQueryList(c.Query("level")); len(levels) > 1 {
+		filter.Level = ""
+		filter.Dimensions.Levels = levels
+	}
+	filter.Dimensions.ExcludeLevels = splitQueryList(c.Query("exclude_level"))
+	filter.Dimensions.MinLevel = c.Query("min_level")
+	filter.Dimensions.Hosts = splitQueryList(c.Query("host"))
+	filter.Dimensions.ExcludeHosts = splitQueryList(c.Query("exclude_host"))
+	filter.Dimensions.Loggers = splitQueryList(c.Query("logger"))
+	filter.Dimensions.ExcludeLoggers = splitQueryList(c.Query("exclude_logger"))
+	filter.Dimensions.ExcludeLoggerRegex = c.Query("exclude_logger_regex")
+	for _, name := range []string{"exclude_level", "min_level", "host", "exclude_host", "logger", "exclude_logger", "exclude_logger_regex"} {
+		if value := c.Query(name); value != "" {
+			params[name] = value
+		}
+	}
+
+	// Parse time filters
+	if startTime := c.Query("start_time"); startTime != "" {
+		if t, err := time.Parse(time.RFC3339, startTime); err == nil {
+			filter.StartTime = t
+		}
+	}
+	if endTime := c.Query("end_time"); endTime != "" {
+		if t, err := time.Parse(time.RFC3339, endTime); err == nil {
+			filter.EndTime = t
+		}
+	}
+
+	// Parse max results
+	if maxResults := c.Query("max_results"); maxResults != "" {
+		if n, err := strconv.Atoi(maxResults); err == nil {
+			filter.MaxResults = n
+		}
+	}
+
+	return filter, params
+}
+
+// splitQueryList splits a comma-separated query parameter, commas within glob braces ({a,b}) do not split.
+// Empty items are skipped.
+func splitQueryList(value string) []string {
+	var items []string
+	braces, start := 0, 0
+	for i := 0; i <= len(value); i++ {
+		if i < len(value) {
+			switch value[i] {
+			case '{':
+				braces++
+			case '}':
+				if braces > 0 {
+					braces--
+				}
+			}
+			if value[i] != ',' || braces > 0 {
+				continue
+			}
+		}
+		if item := strings.TrimSpace(value[start:i]); item != "" {
+			items = append(items, item)
+		}
+		start = i + 1
+	}
+	return items
+}
+
 func startHTTPServer(addr string, store *LogStatStore, hub *Hub, config *AppConfig) {
 	appConfig = config // Store globally for handlers
 	app := fiber.New(fiber.Config{
-		AppName: "WildFly Log Statistics",
+		AppName:   "WildFly Log Statistics",
+		BodyLimit: 64 * 1024 * 1024, // allow large bulk ingest batches
 	})
 
 	// Setup WebSocket routes
@@ -128,105 +226,249 @@ func startHTTPServer(addr string, store *LogStatStore, hub *Hub, config *AppConf
 	// New query API with filters
 	app.Get("/api/query/stats", func(c *fiber.Ctx) error {
 		start := time.Now()
+		filter, params := parseQueryFilter(c)
 
-		filter := QueryFilter{
-			Level:         c.Query("level"),
-			LoggerRegex:   c.Query("logger_regex"),
-			IncludeMemory: c.QueryBool("include_memory", true),
-			IncludeDB:     c.QueryBool("include_db", true),
+		stats, err := store.QueryLogStats(filter)
+		if err != nil {
+			logRequest("/api/query/stats", params, start, 0, err)
+			status := 500
+			if errors.Is(err, errInvalidQuery) {
+				status = 400
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
 
-		params := map[string]string{
-			"level":          c.Query("level"),
-			"logger_regex":   c.Query("logger_regex"),
-			"start_time":     c.Query("start_time"),
-			"end_time":       c.Query("end_time"),
-			"max_results":    c.Query("max_results"),
-			"include_memory": fmt.Sprintf("%v", filter.IncludeMemory),
-			"include_db":     fmt.Sprintf("%v", filter.IncludeDB),
-		}
+		logRequest("/api/query/stats", params, start, len(stats), nil)
+		return c.JSON(stats)
+	})
 
-		// Parse time filters
-		if startTime := c.Query("start_time"); startTime != "" {
-			if t, err := time.Parse(time.RFC3339, startTime); err == nil {
-				filter.StartTime = t
+	// Aggregated stats API (per host, bucket and level, or by the dimensions given in group_by,
+	// optionally compared with earlier periods)
+	app.Get("/api/query/aggregated", func(c *fiber.Ctx) error {
+		start := time.Now()
+		filter, params := parseQueryFilter(c)
+
+		if c.Query("compare") != "" || c.Query("baseline_weeks") != "" {
+			for _, name := range []string{"group_by", "compare", "baseline_weeks"} {
+				if value := c.Query(name); value != "" {
+					params[name] = value
+				}
 			}
-		}
-		if endTime := c.Query("end_time"); endTime != "" {
-			if t, err := time.Parse(time.RFC3339, endTime); err == nil {
-				filter.EndTime = t
+			comparison, err := ParseComparison(c.Query("compare"), c.Query("baseline_weeks"))
+			groupBy := GroupBy{Bucket: true}
+			if err == nil && c.Query("group_by") != "" {
+				groupBy, err = ParseGroupBy(c.Query("group_by"))
 			}
+			if err != nil {
+				logRequest("/api/query/aggregated", params, start, 0, err)
+				return c.Status(400).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+
+			compared, err := store.QueryComparison(filter, groupBy, comparison)
+			if err != nil {
+				logRequest("/api/query/aggregated", params, start, 0, err)
+				status := 500
+				if errors.Is(err, errInvalidQuery) {
+					status = 400
+				}
+				return c.Status(status).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+
+			logRequest("/api/query/aggregated", params, start, len(compared), nil)
+			return c.JSON(compared)
 		}
 
-		// Parse max results
-		if maxResults := c.Query("max_results"); maxResults != "" {
-			if n, err := strconv.Atoi(maxResults); err == nil {
-				filter.MaxResults = n
+		if spec := c.Query("group_by"); spec != "" {
+			params["group_by"] = spec
+			groupBy, err := ParseGroupBy(spec)
+			if err != nil {
+				logRequest("/api/query/aggregated", params, start, 0, err)
+				return c.Status(400).JSON(fiber.Map{
+					"error": err.Error(),
+				})
 			}
+
+			groups, err := store.QueryGroupedStats(filter, groupBy)
+			if err != nil {
+				logRequest("/api/query/aggregated", params, start, 0, err)
+				status := 500
+				if errors.Is(err, errInvalidQuery) {
+					status = 400
+				}
+				return c.Status(status).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+
+			logRequest("/api/query/aggregated", params, start, len(groups), nil)
+			return c.JSON(groups)
 		}
 
-		stats, err := store.QueryLogStats(filter)
+		aggregated, err := store.QueryAggregatedStatsOptimized(filter)
 		if err != nil {
-			logRequest("/api/query/stats", params, start, 0, err)
-			return c.Status(500).JSON(fiber.Map{
+			logRequest("/api/query/aggregated", params, start, 0, err)
+			status := 500
+			if errors.Is(err, errInvalidQuery) {
+				status = 400
+			}
+			return c.Status(status).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
 
-		logRequest("/api/query/stats", params, start, len(stats), nil)
-		return c.JSON(stats)
+		logRequest("/api/query/aggregated", params, start, len(aggregated), nil)
+		return c.JSON(aggregated)
 	})
 
-	// Aggregated stats API
-	app.Get("/api/query/aggregated", func(c *fiber.Ctx) error {
+	// Top groups of the query range by total, rate or share
+	app.Get("/api/query/top", func(c *fiber.Ctx) error {
 		start := time.Now()
+		filter, params := parseQueryFilter(c)
+		q := TopQuery{
+			RankBy: c.Query("rank", "total"),
+			Limit:  c.QueryInt("limit", defaultRankingLimit),
+		}
+		for _, name := range []string{"by", "within", "rank", "limit"} {
+			if value := c.Query(name); value != "" {
+				params[name] = value
+			}
+		}
 
-		filter := QueryFilter{
-			Level:         c.Query("level"),
-			LoggerRegex:   c.Query("logger_regex"),
-			IncludeMemory: c.QueryBool("include_memory", true),
-			IncludeDB:     c.QueryBool("include_db", true),
+		var err error
+		if q.By, err = ParseGroupBy(c.Query("by", "logger")); err == nil && c.Query("within") != "" {
+			q.Within, err = ParseGroupBy(c.Query("within"))
+		}
+		if err != nil {
+			logRequest("/api/query/top", params, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
 
-		params := map[string]string{
-			"level":          c.Query("level"),
-			"logger_regex":   c.Query("logger_regex"),
-			"start_time":     c.Query("start_time"),
-			"end_time":       c.Query("end_time"),
-			"max_results":    c.Query("max_results"),
-			"include_memory": fmt.Sprintf("%v", filter.IncludeMemory),
-			"include_db":     fmt.Sprintf("%v", filter.IncludeDB),
+		entries, err := store.QueryTop(filter, q)
+		if err != nil {
+			logRequest("/api/query/top", params, start, 0, err)
+			status := 500
+			if errors.Is(err, errInvalidRanking) || errors.Is(err, errInvalidQuery) {
+				status = 400
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
 
-		// Parse time filters
-		if startTime := c.Query("start_time"); startTime != "" {
-			if t, err := time.Parse(time.RFC3339, startTime); err == nil {
-				filter.StartTime = t
+		logRequest("/api/query/top", params, start, len(entries), nil)
+		return c.JSON(entries)
+	})
+
+	// Groups that changed most between the query range and the same range an offset earlier
+	app.Get("/api/query/movers", func(c *fiber.Ctx) error {
+		start := time.Now()
+		filter, params := parseQueryFilter(c)
+		q := MoversQuery{
+			SortBy:    c.Query("sort", "absolute"),
+			Direction: c.Query("direction"),
+			MinVolume: c.QueryInt("min_volume", defaultMinVolume),
+			Limit:     c.QueryInt("limit", defaultRankingLimit),
+		}
+		for _, name := range []string{"by", "offset", "sort", "direction", "min_volume", "limit"} {
+			if value := c.Query(name); value != "" {
+				params[name] = value
 			}
 		}
-		if endTime := c.Query("end_time"); endTime != "" {
-			if t, err := time.Parse(time.RFC3339, endTime); err == nil {
-				filter.EndTime = t
+
+		var err error
+		q.By, err = ParseGroupBy(c.Query("by", "logger"))
+		if err == nil {
+			if q.Offset, err = time.ParseDuration(c.Query("offset", defaultMoversOffset.String())); err == nil && q.Offset <= 0 {
+				err = fmt.Errorf("invalid offset %q: must be positive", c.Query("offset"))
 			}
 		}
+		if err != nil {
+			logRequest("/api/query/movers", params, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 
-		// Parse max results
-		if maxResults := c.Query("max_results"); maxResults != "" {
-			if n, err := strconv.Atoi(maxResults); err == nil {
-				filter.MaxResults = n
+		result, err := store.QueryMovers(filter, q)
+		if err != nil {
+			logRequest("/api/query/movers", params, start, 0, err)
+			status := 500
+			if errors.Is(err, errInvalidRanking) || errors.Is(err, errInvalidQuery) {
+				status = 400
 			}
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
 
-		aggregated, err := store.QueryAggregatedStatsOptimized(filter)
+		logRequest("/api/query/movers", params, start, len(result.Movers), nil)
+		return c.JSON(result)
+	})
+
+	// Message patterns ranked by count in the query range
+	app.Get("/api/query/patterns", func(c *fiber.Ctx) error {
+		start := time.Now()
+		filter, params := parseQueryFilter(c)
+
+		patterns, err := store.QueryPatterns(filter)
 		if err != nil {
-			logRequest("/api/query/aggregated", params, start, 0, err)
+			logRequest("/api/query/patterns", params, start, 0, err)
 			return c.Status(500).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
 
-		logRequest("/api/query/aggregated", params, start, len(aggregated), nil)
-		return c.JSON(aggregated)
+		logRequest("/api/query/patterns", params, start, len(patterns), nil)
+		return c.JSON(patterns)
+	})
+
+	// Message pattern counts per time bucket
+	app.Get("/api/query/patterns/timeline", func(c *fiber.Ctx) error {
+		start := time.Now()
+		filter, params := parseQueryFilter(c)
+
+		timeline, err := store.QueryPatternTimeline(filter)
+		if err != nil {
+			logRequest("/api/query/patterns/timeline", params, start, 0, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/query/patterns/timeline", params, start, len(timeline), nil)
+		return c.JSON(timeline)
+	})
+
+	// Top exceptions (stack trace fingerprints) in the query range
+	app.Get("/api/query/exceptions", func(c *fiber.Ctx) error {
+		start := time.Now()
+		filter, params := parseQueryFilter(c)
+
+		exceptions, err := store.QueryExceptions(filter)
+		if err != nil {
+			logRequest("/api/query/exceptions", params, start, 0, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// Sample traces are large, only include them on request
+		if !c.QueryBool("include_sample", false) {
+			for _, exception := range exceptions {
+				exception.SampleTrace = ""
+			}
+		}
+
+		logRequest("/api/query/exceptions", params, start, len(exceptions), nil)
+		return c.JSON(exceptions)
 	})
 
 	// Quick helpers
@@ -454,6 +696,374 @@ func startHTTPServer(addr string, store *LogStatStore, hub *Hub, config *AppConf
 		return c.JSON(buildInfo)
 	})
 
+	// Ingest statistics endpoint
+	app.Get("/api/ingest/stats", func(c *fiber.Ctx) error {
+		start := time.Now()
+		res := store.GetLateStats()
+		for k, v := range store.rejected.GetStats() {
+			res[k] = v
+		}
+		if store.journal != nil {
+			res["journal"] = store.journal.Stats()
+		}
+		if store.archive != nil {
+			res["archive"] = store.archive.Stats()
+		}
+		if store.search != nil {
+			res["search"] = store.GetSearchStats()
+		}
+		logRequest("/api/ingest/stats", map[string]string{}, start, 1, nil)
+		return c.JSON(res)
+	})
+
+	// Flush statistics endpoint
+	app.Get("/api/flush/stats", func(c *fiber.Ctx) error {
+		start := time.Now()
+		res := store.GetFlushStats()
+		logRequest("/api/flush/stats", map[string]string{}, start, 1, nil)
+		return c.JSON(res)
+	})
+
+	// Catalog of hosts, levels and loggers with metadata, most frequent first
+	app.Get("/api/catalog/:dimension", func(c *fiber.Ctx) error {
+		start := time.Now()
+		dimension := c.Params("dimension")
+		params := map[string]string{
+			"dimension":   dimension,
+			"name_regex":  c.Query("name_regex"),
+			"tag":         c.Query("tag"),
+			"max_results": c.Query("max_results"),
+		}
+
+		if !validCatalogDimension(dimension) {
+			err := fmt.Errorf("unknown catalog %q", dimension)
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(404).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		entries, err := store.QueryCatalog(dimension, c.Query("name_regex"), c.Query("tag"), c.QueryInt("max_results", 0))
+		if err != nil {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/catalog", params, start, len(entries), nil)
+		return c.JSON(entries)
+	})
+
+	app.Get("/api/catalog/:dimension/:id", func(c *fiber.Ctx) error {
+		start := time.Now()
+		params := map[string]string{
+			"dimension": c.Params("dimension"),
+			"id":        c.Params("id"),
+		}
+
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil || !validCatalogDimension(c.Params("dimension")) {
+			logRequest("/api/catalog", params, start, 0, fmt.Errorf("not found"))
+			return c.Status(404).JSON(fiber.Map{
+				"error": "catalog entry not found",
+			})
+		}
+
+		entry, err := store.GetCatalogEntry(c.Params("dimension"), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(404).JSON(fiber.Map{
+				"error": "catalog entry not found",
+			})
+		}
+		if err != nil {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/catalog", params, start, 1, nil)
+		return c.JSON(entry)
+	})
+
+	// Sets the user notes and tags of a catalog entry
+	app.Put("/api/catalog/:dimension/:id", func(c *fiber.Ctx) error {
+		start := time.Now()
+		params := map[string]string{
+			"dimension": c.Params("dimension"),
+			"id":        c.Params("id"),
+		}
+
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil || !validCatalogDimension(c.Params("dimension")) {
+			logRequest("/api/catalog", params, start, 0, fmt.Errorf("not found"))
+			return c.Status(404).JSON(fiber.Map{
+				"error": "catalog entry not found",
+			})
+		}
+
+		var body struct {
+			Notes string   `json:"notes"`
+			Tags  []string `json:"tags"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if _, err := normalizeCatalogTags(body.Tags); err != nil {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		entry, err := store.UpdateCatalogEntry(c.Params("dimension"), id, body.Notes, body.Tags)
+		if errors.Is(err, sql.ErrNoRows) {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(404).JSON(fiber.Map{
+				"error": "catalog entry not found",
+			})
+		}
+		if err != nil {
+			logRequest("/api/catalog", params, start, 0, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/catalog", params, start, 1, nil)
+		return c.JSON(entry)
+	})
+
+	// Raw messages from the archive, e.g. of a bucket spiking on the dashboard
+	app.Get("/api/logs/search", func(c *fiber.Ctx) error {
+		start := time.Now()
+		params := map[string]string{
+			"start_time":   c.Query("start_time"),
+			"end_time":     c.Query("end_time"),
+			"bucket_ts":    c.Query("bucket_ts"),
+			"bucket":       c.Query("bucket"),
+			"host":         c.Query("host"),
+			"level":        c.Query("level"),
+			"logger_regex": c.Query("logger_regex"),
+			"q":            c.Query("q"),
+			"max_results":  c.Query("max_results"),
+		}
+
+		if store.archive == nil {
+			err := fmt.Errorf("raw archive is not enabled (-archive-dir)")
+			logRequest("/api/logs/search", params, start, 0, err)
+			return c.Status(404).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		query := ArchiveQuery{
+			Host:        c.Query("host"),
+			Level:       c.Query("level"),
+			LoggerRegex: c.Query("logger_regex"),
+			Text:        c.Query("q"),
+			MaxResults:  c.QueryInt("max_results", 100),
+		}
+
+		// A bucket covers [bucket_ts, bucket_ts + bucket size), start_time/end_time are used otherwise
+		if bucketTS := c.Query("bucket_ts"); bucketTS != "" {
+			bucketStart, err := time.Parse(time.RFC3339, bucketTS)
+			if err != nil {
+				logRequest("/api/logs/search", params, start, 0, err)
+				return c.Status(400).JSON(fiber.Map{
+					"error": "invalid bucket_ts: " + err.Error(),
+				})
+			}
+			bucketSize := store.bucketSize
+			if bucket := c.Query("bucket"); bucket != "" {
+				if bucketSize, err = time.ParseDuration(bucket); err != nil || bucketSize <= 0 {
+					logRequest("/api/logs/search", params, start, 0, fmt.Errorf("invalid bucket %q", bucket))
+					return c.Status(400).JSON(fiber.Map{
+						"error": fmt.Sprintf("invalid bucket %q", bucket),
+					})
+				}
+			}
+			query.StartTime = bucketStart
+			query.EndTime = bucketStart.Add(bucketSize)
+		} else {
+			if startTime := c.Query("start_time"); startTime != "" {
+				if t, err := time.Parse(time.RFC3339, startTime); err == nil {
+					query.StartTime = t
+				}
+			}
+			if endTime := c.Query("end_time"); endTime != "" {
+				if t, err := time.Parse(time.RFC3339, endTime); err == nil {
+					query.EndTime = t
+				}
+			}
+		}
+
+		result, err := store.archive.Search(query)
+		if err != nil {
+			logRequest("/api/logs/search", params, start, 0, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/logs/search", params, start, len(result.Entries), nil)
+		return c.JSON(result)
+	})
+
+	// Full-text search over the indexed messages with snippets and a hit histogram
+	app.Get("/api/search", func(c *fiber.Ctx) error {
+		start := time.Now()
+		params := map[string]string{
+			"q":            c.Query("q"),
+			"start_time":   c.Query("start_time"),
+			"end_time":     c.Query("end_time"),
+			"host":         c.Query("host"),
+			"level":        c.Query("level"),
+			"logger_regex": c.Query("logger_regex"),
+			"order":        c.Query("order"),
+			"bucket":       c.Query("bucket"),
+			"max_results":  c.Query("max_results"),
+		}
+
+		if store.search == nil {
+			err := fmt.Errorf("message search is not enabled (-search-min-level)")
+			logRequest("/api/search", params, start, 0, err)
+			return c.Status(404).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		query := SearchQuery{
+			Query:       c.Query("q"),
+			Host:        c.Query("host"),
+			Level:       c.Query("level"),
+			LoggerRegex: c.Query("logger_regex"),
+			Order:       c.Query("order", "time"),
+			Bucket:      store.bucketSize,
+			MaxResults:  c.QueryInt("max_results", 100),
+		}
+		if startTime := c.Query("start_time"); startTime != "" {
+			if t, err := time.Parse(time.RFC3339, startTime); err == nil {
+				query.StartTime = t
+			}
+		}
+		if endTime := c.Query("end_time"); endTime != "" {
+			if t, err := time.Parse(time.RFC3339, endTime); err == nil {
+				query.EndTime = t
+			}
+		}
+		if bucket := c.Query("bucket"); bucket != "" {
+			bucketSize, err := time.ParseDuration(bucket)
+			if err != nil {
+				logRequest("/api/search", params, start, 0, err)
+				return c.Status(400).JSON(fiber.Map{
+					"error": fmt.Sprintf("invalid bucket %q", bucket),
+				})
+			}
+			query.Bucket = bucketSize
+		}
+
+		result, err := store.SearchMessages(query)
+		if err != nil {
+			logRequest("/api/search", params, start, 0, err)
+			status := 500
+			if errors.Is(err, errInvalidSearchQuery) {
+				status = 400
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/search", params, start, len(result.Hits), nil)
+		return c.JSON(result)
+	})
+
+	// Bulk ingest endpoint (NDJSON or JSON array, optionally gzip encoded)
+	app.Post("/api/ingest", func(c *fiber.Ctx) error {
+		start := time.Now()
+		params := map[string]string{
+			"remote":           c.IP(),
+			"content_encoding": c.Get(fiber.HeaderContentEncoding),
+		}
+
+		// Decompressed here rather than by Body(), which hides decode errors and has no size limit
+		body, err := decodeIngestBody(c.Request().Body(), c.Get(fiber.HeaderContentEncoding))
+		if err != nil {
+			logRequest("/api/ingest", params, start, 0, err)
+			status := 400
+			if errors.Is(err, errUnsupportedEncoding) {
+				status = 415
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		result, err := store.ingestJsonBatch(body, c.IP())
+		if err != nil {
+			logRequest("/api/ingest", params, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		logRequest("/api/ingest", params, start, result.Accepted, nil)
+		return c.JSON(result)
+	})
+
+	// Rejected (unparseable) lines endpoint
+	app.Get("/api/ingest/rejected", func(c *fiber.Ctx) error {
+		start := time.Now()
+		entries := store.rejected.GetAll()
+		res := store.rejected.GetStats()
+		res["entries"] = entries
+		logRequest("/api/ingest/rejected", map[string]string{}, start, len(entries), nil)
+		return c.JSON(res)
+	})
+
+	// Ingest rules endpoints
+	app.Get("/api/rules", func(c *fiber.Ctx) error {
+		start := time.Now()
+		rules := store.rules.GetRules()
+		logRequest("/api/rules", map[string]string{}, start, len(rules), nil)
+		return c.JSON(fiber.Map{
+			"rules": rules,
+			"stats": store.rules.GetStats(),
+		})
+	})
+
+	app.Post("/api/rules/reload", func(c *fiber.Ctx) error {
+		start := time.Now()
+		if err := store.rules.Reload(); err != nil {
+			logRequest("/api/rules/reload", map[string]string{}, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		logRequest("/api/rules/reload", map[string]string{}, start, len(store.rules.GetRules()), nil)
+		return c.JSON(store.rules.GetStats())
+	})
+
+	// Shows what a sample JSON log line (request body) becomes after the ingest rules
+	app.Post("/api/rules/test", func(c *fiber.Ctx) error {
+		start := time.Now()
+		res, err := store.TestRules(string(c.Body()))
+		if err != nil {
+			logRequest("/api/rules/test", map[string]string{}, start, 0, err)
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		logRequest("/api/rules/test", map[string]string{}, start, 1, nil)
+		return c.JSON(res)
+	})
+
 	// Configuration endpoint
 	app.Get("/api/config", func(c *fiber.Ctx) error {
 		start := time.Now()
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldMapping defines which JSON fields are used for the log entry fields.
+// Each field has a list of candidates tried in order; dotted paths (e.g. "log.level")
+// address nested objects.
+type FieldMapping struct {
+	Level      []string `json:"level"`
+	Logger     []string `json:"logger"`
+	Host       []string `json:"host"`
+	Message    []string `json:"message"`
+	StackTrace []string `json:"stack_trace"`
+	Timestamp  []string `json:"timestamp"`
+
+	// Optional context fields
+	ThreadName      []string `json:"thread_name"`
+	ThreadID        []string `json:"thread_id"`
+	Sequence        []string `json:"sequence"`
+	LoggerClassName []string `json:"logger_class_name"`
+	NDC             []string `json:"ndc"`
+	MDC             []string `json:"mdc"` // must point to an object of key/value pairs
+}
+
+// timestampLayouts are tried in order when parsing string timestamps
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700", // Logback / Log4j without colon in offset
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// DefaultFieldMapping returns a mapping covering WildFly json-formatter / socket-handler,
+// Logback JSON (logstash-logback-encoder) and Elastic Common Schema (ECS) output
+func DefaultFieldMapping() *FieldMapping {
+	return &FieldMapping{
+		Level:      []string{"level", "log.level", "severity"},
+		Logger:     []string{"loggerName", "logger", "logger_name", "log.logger"},
+		Host:       []string{"hostName", "host", "HOSTNAME", "host.name", "hostname"},
+		Message:    []string{"message", "msg"},
+		StackTrace: []string{"stackTrace", "stacktrace", "stack_trace", "error.stack_trace"},
+		Timestamp:  []string{"timestamp", "@timestamp", "time"},
+
+		ThreadName:      []string{"threadName", "thread_name", "thread", "process.thread.name"},
+		ThreadID:        []string{"threadId", "thread_id", "process.thread.id"},
+		Sequence:        []string{"sequence", "sequenceNumber"},
+		LoggerClassName: []string{"loggerClassName"},
+		NDC:             []string{"ndc"},
+		MDC:             []string{"mdc", "contextMap"},
+	}
+}
+
+// LoadFieldMapping reads a mapping from a JSON file. Fields not set in the file
+// keep their default candidates.
+func LoadFieldMapping(path string) (*FieldMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileMapping FieldMapping
+	if err := json.Unmarshal(data, &fileMapping); err != nil {
+		return nil, fmt.Errorf("parsing field mapping %s: %w", path, err)
+	}
+
+	mapping := DefaultFieldMapping()
+	if len(fileMapping.Level) > 0 {
+		mapping.Level = fileMapping.Level
+	}
+	if len(fileMapping.Logger) > 0 {
+		mapping.Logger = fileMapping.Logger
+	}
+	if len(fileMapping.Host) > 0 {
+		mapping.Host = fileMapping.Host
+	}
+	if len(fileMapping.Message) > 0 {
+		mapping.Message = fileMapping.Message
+	}
+	if len(fileMapping.StackTrace) > 0 {
+		mapping.StackTrace = fileMapping.StackTrace
+	}
+	if len(fileMapping.Timestamp) > 0 {
+		mapping.Timestamp = fileMapping.Timestamp
+	}
+	if len(fileMapping.ThreadName) > 0 {
+		mapping.ThreadName = fileMapping.ThreadName
+	}
+	if len(fileMapping.ThreadID) > 0 {
+		mapping.ThreadID = fileMapping.ThreadID
+	}
+	if len(fileMapping.Sequence) > 0 {
+		mapping.Sequence = fileMapping.Sequence
+	}
+	if len(fileMapping.LoggerClassName) > 0 {
+		mapping.LoggerClassName = fileMapping.LoggerClassName
+	}
+	if len(fileMapping.NDC) > 0 {
+		mapping.NDC = fileMapping.NDC
+	}
+	if len(fileMapping.MDC) > 0 {
+		mapping.MDC = fileMapping.MDC
+	}
+
+	return mapping, nil
+}
+
+// Extract builds a RawLogEntry from a parsed JSON object using the mapping
+func (m *FieldMapping) Extract(logEntry map[string]interface{}) *RawLogEntry {
+	entry := &RawLogEntry{
+		Level:      lookupString(logEntry, m.Level),
+		Logger:     lookupString(logEntry, m.Logger),
+		Host:       lookupString(logEntry, m.Host),
+		Message:    lookupString(logEntry, m.Message),
+		StackTrace: lookupString(logEntry, m.StackTrace),
+		Timestamp:  time.Now(),
+
+		ThreadName:      lookupString(logEntry, m.ThreadName),
+		ThreadID:        lookupInt(logEntry, m.ThreadID),
+		Sequence:        lookupInt(logEntry, m.Sequence),
+		LoggerClassName: lookupString(logEntry, m.LoggerClassName),
+		NDC:             lookupString(logEntry, m.NDC),
+		MDC:             lookupStringMap(logEntry, m.MDC),
+	}
+
+	if value, ok := lookupFirst(logEntry, m.Timestamp); ok {
+		if ts, ok := parseTimestampValue(value); ok {
+			entry.Timestamp = ts
+		}
+	}
+
+	return entry
+}
+
+// lookupFirst returns the value of the first candidate path present in the object.
+// Objects and arrays are skipped so that e.g. ECS "host": {"name": ...} falls through to "host.name".
+func lookupFirst(obj map[string]interface{}, paths []string) (interface{}, bool) {
+	for _, path := range paths {
+		value, ok := lookupPath(obj, path)
+		if !ok || value == nil {
+			continue
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+// lookupString returns the first candidate value as string ("" if none present)
+func lookupString(obj map[string]interface{}, paths []string) string {
+	value, ok := lookupFirst(obj, paths)
+	if !ok {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if f, ok := value.(float64); ok && f == float64(int64(f)) {
+		return fmt.Sprintf("%d", int64(f))
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// lookupInt returns the first candidate value as integer (0 if none present or not numeric)
+func lookupInt(obj map[string]interface{}, paths []string) int64 {
+	value, ok := lookupFirst(obj, paths)
+	if !ok {
+		return 0
+	}
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// lookupStringMap returns the first candidate object as string map (nil if none present)
+func lookupStringMap(obj map[string]interface{}, paths []string) map[string]string {
+	for _, path := range paths {
+		value, ok := lookupPath(obj, path)
+		if !ok {
+			continue
+		}
+		nested, ok := value.(map[string]interface{})
+		if !ok || len(nested) == 0 {
+			continue
+		}
+		result := make(map[string]string, len(nested))
+		for k, v := range nested {
+			if s, ok := v.(string); ok {
+				result[k] = s
+			} else {
+				result[k] = fmt.Sprintf("%v", v)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// lookupPath resolves a dotted path. A literal key containing dots (flattened ECS)
+// takes precedence over nested traversal.
+func lookupPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := obj[path]; ok {
+		return value, true
+	}
+
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := obj[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(nested, rest)
+}
+
+// parseTimestampValue parses a string timestamp or a numeric epoch (seconds or milliseconds)
+func parseTimestampValue(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, layout := range timestampLayouts {
+			if ts, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return ts, true
+			}
+		}
+	case float64:
+		if v > 1e12 {
+			// Epoch milliseconds
+			return time.UnixMilli(int64(v)), true
+		}
+		sec := int64(v)
+		return time.Unix(sec, int64((v-float64(sec))*1e9)), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gelfMaxChunks       = 128              // maximum number of chunks per message (GELF spec)
+	gelfChunkTimeout    = 5 * time.Second  // incomplete chunked messages are discarded after this
+	gelfMaxMessageSize  = 8 * 1024 * 1024  // maximum size of a (decompressed) GELF message
+	gelfMaxPendingSets  = 1024             // incomplete chunked messages kept, the oldest is dropped beyond
+	gelfMaxPendingBytes = 32 * 1024 * 1024 // chunk bytes of incomplete messages kept, the oldest is dropped beyond
+	gelfChunkHeaderLen  = 12               // magic (2) + message id (8) + sequence number (1) + count (1)
+	gelfChunkMagic0     = 0x1e             // first byte of chunked GELF magic
+	gelfChunkMagic1     = 0x0f             // second byte of chunked GELF magic
+	gelfDefaultLogger   = "gelf"           // logger name if message carries none
+)
+
+// gelfLoggerKeys lists the additional fields checked (in order) for the logger name
+var gelfLoggerKeys = []string{"_logger", "_LoggerName", "_loggerName", "_facility", "facility"}
+
+// gelfChunkSet collects the chunks of a single chunked GELF message
+type gelfChunkSet struct {
+	chunks   [][]byte
+	received int
+	size     int // bytes of the received chunks
+	created  time.Time
+}
+
+// GelfChunkAssembler reassembles chunked GELF UDP messages. The incomplete messages kept are limited
+// in number and bytes, so a sender spraying message IDs cannot exhaust memory.
+type GelfChunkAssembler struct {
+	pending      map[string]*gelfChunkSet // key: 8 byte message id
+	pendingBytes int                      // bytes of all pending chunks
+	dropped      int64                    // incomplete messages dropped to stay within the limits
+	mu           sync.Mutex
+}
+
+// NewGelfChunkAssembler creates a new chunk assembler
+func NewGelfChunkAssembler() *GelfChunkAssembler {
+	return &GelfChunkAssembler{
+		pending: make(map[string]*gelfChunkSet),
+	}
+}
+
+// Add adds a chunk and returns the complete message once all chunks have arrived (nil otherwise)
+func (a *GelfChunkAssembler) Add(datagram []byte) ([]byte, error) {
+	if len(datagram) < gelfChunkHeaderLen {
+		return nil, errors.New("GELF chunk too short")
+	}
+
+	msgID := string(datagram[2:10])
+	seqNum := int(datagram[10])
+	seqCount := int(datagram[11])
+	if seqCount < 1 || seqCount > gelfMaxChunks || seqNum >= seqCount {
+		return nil, fmt.Errorf("invalid GELF chunk %d/%d", seqNum, seqCount)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	set, exists := a.pending[msgID]
+	if !exists {
+		if len(a.pending) >= gelfMaxPendingSets {
+			a.dropOldest("")
+		}
+		set = &gelfChunkSet{
+			chunks:  make([][]byte, seqCount),
+			created: time.Now(),
+		}
+		a.pending[msgID] = set
+	}
+	if len(set.chunks) != seqCount {
+		a.remove(msgID)
+		return nil, errors.New("GELF chunk count mismatch")
+	}
+
+	if set.chunks[seqNum] == nil {
+		chunk := datagram[gelfChunkHeaderLen:]
+		if set.size+len(chunk) > gelfMaxMessageSize {
+			a.remove(msgID)
+			return nil, fmt.Errorf("GELF message exceeds %d bytes", gelfMaxMessageSize)
+		}
+		for a.pendingBytes+len(chunk) > gelfMaxPendingBytes {
+			if !a.dropOldest(msgID) {
+				break
+			}
+		}
+		set.chunks[seqNum] = append([]byte(nil), chunk...)
+		set.received++
+		set.size += len(chunk)
+		a.pendingBytes += len(chunk)
+	}
+
+	if set.received < seqCount {
+		return nil, nil
+	}
+
+	// All chunks received, concatenate
+	a.remove(msgID)
+	message := bytes.Join(set.chunks, nil)
+	if len(message) > gelfMaxMessageSize {
+		return nil, fmt.Errorf("GELF message exceeds %d bytes", gelfMaxMessageSize)
+	}
+	return message, nil
+}
+
+// remove discards a pending message. Callers hold a.mu.
+func (a *GelfChunkAssembler) remove(msgID string) {
+	if set, exists := a.pending[msgID]; exists {
+		a.pendingBytes -= set.size
+		delete(a.pending, msgID)
+	}
+}
+
+// dropOldest drops the oldest pending message other than keep and counts it, returns false if there
+// is none. Callers hold a.mu.
+func (a *GelfChunkAssembler) dropOldest(keep string) bool {
+	oldestID := ""
+	var oldest *gelfChunkSet
+	for id, set := range a.pending {
+		if id != keep && (oldest == nil || set.created.Before(oldest.created)) {
+			oldestID, oldest = id, set
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	a.remove(oldestID)
+	a.dropped++
+	return true
+}
+
+// Dropped returns the number of incomplete messages dropped to stay within the pending limits
+func (a *GelfChunkAssembler) Dropped() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.dropped
+}
+
+// Expire discards incomplete messages older than the chunk timeout and returns how many were dropped
+func (a *GelfChunkAssembler) Expire() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	expired := 0
+	cutoff := time.Now().Add(-gelfChunkTimeout)
+	for id, set := range a.pending {
+		if set.created.Before(cutoff) {
+			a.remove(id)
+			expired++
+		}
+	}
+	return expired
+}
+
+// StartGelfUDP starts a GELF listener on UDP (chunked, gzip/zlib compressed or plain)
+func StartGelfUDP(addr string, store *LogStatStore, verbose bool) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	assembler := NewGelfChunkAssembler()
+
+	// Periodically discard incomplete chunked messages
+	go func() {
+		ticker := time.NewTicker(gelfChunkTimeout)
+		defer ticker.Stop()
+
+		var lastDropped int64
+		for range ticker.C {
+			if n := assembler.Expire(); n > 0 && verbose {
+				log.Printf("GELF: discarded %d incomplete chunked messages\n", n)
+			}
+			if dropped := assembler.Dropped(); dropped > lastDropped {
+				log.Printf("GELF: dropped %d incomplete chunked messages over the pending limits (%d total)\n", dropped-lastDropped, dropped)
+				lastDropped = dropped
+			}
+		}
+	}()
+
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 64*1024)
+		for {
+			n, remote, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Printf("GELF UDP read error: %v\n", err)
+				return
+			}
+
+			datagram := buf[:n]
+			remoteAddr := remote.String()
+
+			// Reassemble chunked messages
+			if n >= 2 && datagram[0] == gelfChunkMagic0 && datagram[1] == gelfChunkMagic1 {
+				complete, err := assembler.Add(datagram)
+				if err != nil {
+					store.rejected.Add(remoteAddr, string(datagram), err)
+					continue
+				}
+				if complete == nil {
+					continue
+				}
+				datagram = complete
+			}
+
+			payload, err := decompressGelf(datagram)
+			if err != nil {
+				store.rejected.Add(remoteAddr, string(datagram), err)
+				continue
+			}
+			store.handleGelfMessage(payload, remoteAddr)
+		}
+	}()
+
+	return nil
+}
+
+// StartGelfTCP starts a GELF listener on TCP (null byte delimited, uncompressed)
+func StartGelfTCP(addr string, store *LogStatStore, verbose bool) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("GELF TCP accept error: %v\n", err)
+				return
+			}
+
+			if verbose {
+				log.Printf("=== New GELF connection from %s ===", conn.RemoteAddr())
+			}
+			go handleGelfConnection(conn, store, verbose)
+		}
+	}()
+
+	return nil
+}
+
+// handleGelfConnection reads null byte delimited GELF messages from a TCP connection
+func handleGelfConnection(conn net.Conn, store *LogStatStore, verbose bool) {
+	defer conn.Close()
+
+	remoteAddr := conn.RemoteAddr().String()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), gelfMaxMessageSize)
+	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	for scanner.Scan() {
+		// Some senders additionally terminate messages with a newline
+		payload := bytes.TrimSpace(scanner.Bytes())
+		if len(payload) == 0 {
+			continue
+		}
+		store.handleGelfMessage(payload, remoteAddr)
+	}
+
+	if err := scanner.Err(); err != nil && verbose {
+		log.Printf("GELF connection error from %s: %v\n", remoteAddr, err)
+	}
+
+	if verbose {
+		log.Printf("GELF connection closed: %s\n", remoteAddr)
+	}
+}
+
+// decompressGelf detects gzip or zlib compression by magic bytes and decompresses the payload
+func decompressGelf(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) >= 2 && data[0] == 0x78:
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(reader, gelfMaxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > gelfMaxMessageSize {
+		return nil, fmt.Errorf("GELF message exceeds %d bytes", gelfMaxMessageSize)
+	}
+	return payload, nil
+}
+
+// handleGelfMessage parses a GELF JSON payload and adds it to the store
+func (s *LogStatStore) handleGelfMessage(payload []byte, remoteAddr string) {
+	entry, err := parseGelfMessage(payload)
+	if err != nil {
+		s.rejected.Add(remoteAddr, string(payload), err)
+		if s.verbose {
+			log.Printf("Rejected GELF message from %s: %v\n", remoteAddr, err)
+		}
+		return
+	}
+
+	if entry.Host == "" {
+		entry.Host = hostFromRemoteAddr(remoteAddr)
+	}
+
+	s.ingestEntry(entry)
+}
+
+// parseGelfMessage maps a GELF 1.1 message to a RawLogEntry
+func parseGelfMessage(payload []byte) (*RawLogEntry, error) {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+
+	shortMessage, _ := msg["short_message"].(string)
+	fullMessage, _ := msg["full_message"].(string)
+	if shortMessage == "" && fullMessage == "" {
+		return nil, errors.New("GELF message without short_message")
+	}
+
+	entry := &RawLogEntry{
+		Level:   "INFO", // used if the optional level field is missing
+		Logger:  gelfDefaultLogger,
+		Message: shortMessage,
+	}
+
+	if h, ok := msg["host"].(string); ok {
+		entry.Host = h
+	}
+
+	// Level: numeric syslog severity (some senders use strings)
+	switch lvl := msg["level"].(type) {
+	case float64:
+		entry.Level = syslogSeverityToLevel(int(lvl))
+	case string:
+		if n, err := strconv.Atoi(lvl); err == nil {
+			entry.Level = syslogSeverityToLevel(n)
+		} else if lvl != "" {
+			entry.Level = lvl
+		}
+	}
+
+	for _, key := range gelfLoggerKeys {
+		if l, ok := msg[key].(string); ok && l != "" {
+			entry.Logger = l
+			break
+		}
+	}
+
+	// Timestamp: seconds since epoch with optional decimal places
+	if ts, ok := msg["timestamp"].(float64); ok && ts > 0 {
+		sec := int64(ts)
+		entry.Timestamp = time.Unix(sec, int64((ts-float64(sec))*1e9))
+	}
+
+	// Stack trace: explicit field, otherwise the full message if it looks like one. Other full messages
+	// (multi-line texts) extend the message.
+	if st, ok := msg["_StackTrace"].(string); ok && st != "" {
+		entry.StackTrace = st
+	} else if fullMessage != "" && fullMessage != shortMessage {
+		switch {
+		case looksLikeStackTrace(fullMessage):
+			entry.StackTrace = fullMessage
+			if entry.Message == "" {
+				entry.Message, _, _ = strings.Cut(fullMessage, "\n")
+			}
+		case entry.Message == "" || strings.HasPrefix(fullMessage, entry.Message):
+			entry.Message = fullMessage
+		default:
+			entry.Message += "\n" + fullMessage
+		}
+	}
+
+	return entry, nil
+}
+
+// looksLikeStackTrace reports whether a text carries a stack trace (Java frames or exception, Python traceback)
+func looksLikeStackTrace(text string) bool {
+	return strings.Contains(text, "\n\tat ") || strings.Contains(text, "Exception") ||
+		strings.Contains(text, "Traceback (most recent call last)")
+}
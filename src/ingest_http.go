@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Bulk ingest limits
+const (
+	maxIngestErrors      = 10                // error details returned per batch
+	maxIngestDecodedSize = 256 * 1024 * 1024 // decompressed size of a request body
+)
+
+// errUnsupportedEncoding is returned for request bodies with a content encoding other than gzip
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// errNotJSONObject is returned for entries that are valid JSON but not an object (e.g. null)
+var errNotJSONObject = errors.New("not a JSON object")
+
+// decodeIngestBody decompresses a bulk ingest body according to its Content-Encoding. The decompressed
+// size is limited, as the body limit only applies to the compressed size.
+func decodeIngestBody(body []byte, contentEncoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+	default:
+		return nil, fmt.Errorf("%w %q (allowed: gzip)", errUnsupportedEncoding, contentEncoding)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	defer zr.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(zr, maxIngestDecodedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	if len(decoded) > maxIngestDecodedSize {
+		return nil, fmt.Errorf("decompressed body exceeds %d MB", maxIngestDecodedSize/(1024*1024))
+	}
+	return decoded, nil
+}
+
+// IngestResult summarizes the outcome of a bulk ingest request
+type IngestResult struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"` // first few error details
+}
+
+// addError records a rejected entry and keeps the first few error details
+func (r *IngestResult) addError(position int, err error) {
+	r.Rejected++
+	if len(r.Errors) < maxIngestErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("entry %d: %v", position, err))
+	}
+}
+
+// ingestJsonBatch ingests a batch of log entries given as JSON array or NDJSON (one object per line)
+func (s *LogStatStore) ingestJsonBatch(body []byte, remoteAddr string) (*IngestResult, error) {
+	result := &IngestResult{}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return result, nil
+	}
+
+	// JSON array
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+
+		for i, item := range items {
+			var logEntry map[string]interface{}
+			if err := json.Unmarshal(item, &logEntry); err != nil || logEntry == nil {
+				if err == nil {
+					err = errNotJSONObject
+				}
+				s.rejected.Add(remoteAddr, string(item), err)
+				result.addError(i+1, err)
+				continue
+			}
+			s.ingestEntry(s.extractJsonLogEntry(logEntry))
+			result.Accepted++
+		}
+
+		return result, nil
+	}
+
+	// NDJSON
+	for i, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := s.handleJsonLogEntry(string(line), remoteAddr, ""); err != nil {
+			result.addError(i+1, err)
+			continue
+		}
+		result.Accepted++
+	}
+
+	return result, nil
+}
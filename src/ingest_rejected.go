@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dead-letter store limits
+const (
+	maxRejectedLineLength = 4096    // stored size of a single rejected line
+	maxRejectedRemotes    = 1024    // remote hosts counted separately, further hosts are counted as "other"
+	rejectedOtherRemotes  = "other" // counter of the hosts beyond maxRejectedRemotes
+)
+
+// RejectedLine represents an incoming line that could not be parsed
+type RejectedLine struct {
+	Timestamp  string `json:"timestamp"`   // time the line was received (RFC3339)
+	RemoteAddr string `json:"remote_addr"` // address of the sending connection
+	Reason     string `json:"reason"`      // parse error
+	Line       string `json:"line"`        // raw line (truncated to maxRejectedLineLength)
+	Truncated  bool   `json:"truncated"`   // true if the line was truncated
+}
+
+// RejectedStore is a bounded dead-letter store for lines that failed to parse
+type RejectedStore struct {
+	entries    []*RejectedLine  // ring buffer of most recent rejected lines
+	next       int              // next write position in ring buffer
+	maxEntries int              // capacity of ring buffer
+	total      int64            // total number of rejected lines
+	byRemote   map[string]int64 // parse failures per remote host
+	mu         sync.RWMutex
+}
+
+// NewRejectedStore creates a new dead-letter store keeping at most maxEntries lines
+func NewRejectedStore(maxEntries int) *RejectedStore {
+	return &RejectedStore{
+		entries:    make([]*RejectedLine, 0, maxEntries),
+		maxEntries: maxEntries,
+		byRemote:   make(map[string]int64),
+	}
+}
+
+// Add records a rejected line, overwriting the oldest entry once the store is full
+func (r *RejectedStore) Add(remoteAddr, line string, reason error) {
+	entry := &RejectedLine{
+		Timestamp:  time.Now().Format(time.RFC3339),
+		RemoteAddr: remoteAddr,
+		Reason:     reason.Error(),
+		Line:       line,
+	}
+	if len(line) > maxRejectedLineLength {
+		// Copy, so the stored prefix does not keep the whole line alive
+		entry.Line = strings.Clone(line[:maxRejectedLineLength])
+		entry.Truncated = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total++
+	// Counted per host, a client reconnects with a new port
+	host := hostFromRemoteAddr(remoteAddr)
+	if _, exists := r.byRemote[host]; !exists && len(r.byRemote) >= maxRejectedRemotes {
+		host = rejectedOtherRemotes
+	}
+	r.byRemote[host]++
+
+	if r.maxEntries <= 0 {
+		return
+	}
+	if len(r.entries) < r.maxEntries {
+		r.entries = append(r.entries, entry)
+	} else {
+		r.entries[r.next] = entry
+	}
+	r.next = (r.next + 1) % r.maxEntries
+}
+
+// GetAll returns the stored rejected lines, newest first
+func (r *RejectedStore) GetAll() []*RejectedLine {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*RejectedLine, 0, len(r.entries))
+	for i := 1; i <= len(r.entries); i++ {
+		idx := (r.next - i + len(r.entries)) % len(r.entries)
+		entryCopy := *r.entries[idx]
+		result = append(result, &entryCopy)
+	}
+	return result
+}
+
+// GetStats returns rejection counters, overall and per remote host
+func (r *RejectedStore) GetStats() map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byRemote := make(map[string]int64, len(r.byRemote))
+	for addr, n := range r.byRemote {
+		byRemote[addr] = n
+	}
+
+	return map[string]interface{}{
+		"rejected_total":     r.total,
+		"rejected_by_remote": byRemote,
+		"stored":             len(r.entries),
+		"max_stored":         r.maxEntries,
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// RuleCondition matches a field of a log entry against a regex or glob pattern
+type RuleCondition struct {
+	Field  string `json:"field"`            // "logger", "host", "level" or "message"
+	Regex  string `json:"regex,omitempty"`  // regex, named groups become variables
+	Glob   string `json:"glob,omitempty"`   // glob pattern (alternative to regex)
+	Negate bool   `json:"negate,omitempty"` // condition matches if the pattern does NOT match
+}
+
+// RuleExtract extracts variables from a field via named regex groups without affecting the match
+type RuleExtract struct {
+	Field    string            `json:"field"`
+	Regex    string            `json:"regex"`
+	Defaults map[string]string `json:"defaults,omitempty"` // values used if the regex does not match
+}
+
+// IngestRule rewrites or drops log entries matching all conditions.
+// Templates may reference ${logger}, ${host}, ${level}, ${message} and extracted variables.
+type IngestRule struct {
+	Name      string            `json:"name"`
+	When      []RuleCondition   `json:"when"`
+	Extract   []RuleExtract     `json:"extract,omitempty"`
+	SetLogger string            `json:"set_logger,omitempty"`
+	SetHost   string            `json:"set_host,omitempty"`
+	SetLevel  string            `json:"set_level,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Drop      bool              `json:"drop,omitempty"`
+	Stop      bool              `json:"stop,omitempty"` // do not apply further rules after this one
+}
+
+// compiledCondition holds a condition with its compiled pattern
+type compiledCondition struct {
+	field  string
+	regex  *regexp.Regexp
+	glob   glob.Glob
+	negate bool
+}
+
+// compiledExtract holds an extraction with its compiled regex
+type compiledExtract struct {
+	field    string
+	regex    *regexp.Regexp
+	defaults map[string]string
+}
+
+// compiledRule holds a rule with compiled patterns
+type compiledRule struct {
+	rule       IngestRule
+	conditions []compiledCondition
+	extracts   []compiledExtract
+}
+
+// RuleEngine applies ingest rules to log entries. Rules can be loaded from
+// a JSON file and are reloaded when the file changes.
+type RuleEngine struct {
+	rules    []*compiledRule
+	path     string           // rules file ("" = built-in defaults)
+	modTime  time.Time        // modification time of the loaded rules file
+	matched  map[string]int64 // number of matches per rule name
+	dropped  int64            // number of entries dropped by rules
+	loadedAt time.Time
+	mu       sync.RWMutex
+}
+
+// RuleResult describes what the rules did to an entry
+type RuleResult struct {
+	Matched []string `json:"matched"` // names of matching rules
+	Dropped bool     `json:"dropped"`
+}
+
+// DefaultIngestRules returns the built-in rules used when no rules file is given
+func DefaultIngestRules() []IngestRule {
+	return []IngestRule{
+		{
+			// EJB timer loggers: append the timer id from the message, pattern = "timedObjectId=restjms19.restjms19.SchedMe"
+			Name: "timer-id",
+			When: []RuleCondition{
+				{Field: "logger", Regex: `(?i)timer`},
+				{Field: "logger", Regex: `(?i)peter`, Negate: true},
+			},
+			Extract: []RuleExtract{
+				{Field: "message", Regex: `timedObjectId=(?P<timer_id>[^\s\)]+)`, Defaults: map[string]string{"timer_id": "Unknown"}},
+			},
+			SetLogger: "${logger}:${timer_id}",
+		},
+	}
+}
+
+// NewRuleEngine creates a rule engine with the given rules
+func NewRuleEngine(rules []IngestRule) (*RuleEngine, error) {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RuleEngine{
+		rules:    compiled,
+		matched:  make(map[string]int64),
+		loadedAt: time.Now(),
+	}, nil
+}
+
+// LoadRuleEngine creates a rule engine from a JSON rules file
+func LoadRuleEngine(path string) (*RuleEngine, error) {
+	engine := &RuleEngine{
+		path:    path,
+		matched: make(map[string]int64),
+	}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// compileRules validates rules and compiles their patterns
+func compileRules(rules []IngestRule) ([]*compiledRule, error) {
+	var compiled []*compiledRule
+
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		cr := &compiledRule{rule: rule}
+
+		for _, cond := range rule.When {
+			if !isRuleField(cond.Field) {
+				return nil, fmt.Errorf("rule %s: unknown field %q", rule.Name, cond.Field)
+			}
+			cc := compiledCondition{field: cond.Field, negate: cond.Negate}
+			switch {
+			case cond.Regex != "":
+				re, err := regexp.Compile(cond.Regex)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+				}
+				cc.regex = re
+			case cond.Glob != "":
+				g, err := glob.Compile(cond.Glob)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+				}
+				cc.glob = g
+			default:
+				return nil, fmt.Errorf("rule %s: condition on %s needs regex or glob", rule.Name, cond.Field)
+			}
+			cr.conditions = append(cr.conditions, cc)
+		}
+
+		for _, ex := range rule.Extract {
+			if !isRuleField(ex.Field) {
+				return nil, fmt.Errorf("rule %s: unknown field %q", rule.Name, ex.Field)
+			}
+			re, err := regexp.Compile(ex.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			cr.extracts = append(cr.extracts, compiledExtract{field: ex.Field, regex: re, defaults: ex.Defaults})
+		}
+
+		compiled = append(compiled, cr)
+	}
+
+	return compiled, nil
+}
+
+// isRuleField reports whether rules can match on the given field
+func isRuleField(field string) bool {
+	switch field {
+	case "logger", "host", "level", "message":
+		return true
+	}
+	return false
+}
+
+// ruleFieldValue returns the value of a rule field of an entry
+func ruleFieldValue(entry *RawLogEntry, field string) string {
+	switch field {
+	case "logger":
+		return entry.Logger
+	case "host":
+		return entry.Host
+	case "level":
+		return entry.Level
+	case "message":
+		return entry.Message
+	}
+	return ""
+}
+
+// Reload re-reads the rules file. On error the current rules are kept.
+func (e *RuleEngine) Reload() error {
+	if e.path == "" {
+		return fmt.Errorf("no rules file configured")
+	}
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+
+	var rules []IngestRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parsing rules file %s: %w", e.path, err)
+	}
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = compiled
+	e.modTime = info.ModTime()
+	e.loadedAt = time.Now()
+	return nil
+}
+
+// Watch polls the rules file and reloads it when its modification time changes
+func (e *RuleEngine) Watch(interval time.Duration) {
+	if e.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(e.path)
+		if err != nil {
+			continue
+		}
+
+		e.mu.RLock()
+		changed := !info.ModTime().Equal(e.modTime)
+		e.mu.RUnlock()
+
+		if changed {
+			if err := e.Reload(); err != nil {
+				log.Printf("Error reloading rules from %s (keeping current rules): %v\n", e.path, err)
+			} else {
+				log.Printf("=== Reloaded %d ingest rules from %s ===\n", len(e.GetRules()), e.path)
+			}
+		}
+	}
+}
+
+// Apply applies all matching rules to the entry in order
+func (e *RuleEngine) Apply(entry *RawLogEntry) *RuleResult {
+	result := e.evaluate(entry)
+
+	if len(result.Matched) > 0 {
+		e.mu.Lock()
+		for _, name := range result.Matched {
+			e.matched[name]++
+		}
+		if result.Dropped {
+			e.dropped++
+		}
+		e.mu.Unlock()
+	}
+
+	return result
+}
+
+// Test applies the rules to the entry without updating match statistics
+func (e *RuleEngine) Test(entry *RawLogEntry) *RuleResult {
+	return e.evaluate(entry)
+}
+
+// evaluate applies the rules to the entry
+func (e *RuleEngine) evaluate(entry *RawLogEntry) *RuleResult {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	result := &RuleResult{Matched: []string{}}
+
+	for _, cr := range rules {
+		vars, ok := cr.match(entry)
+		if !ok {
+			continue
+		}
+		result.Matched = append(result.Matched, cr.rule.Name)
+
+		if cr.rule.Drop {
+			result.Dropped = true
+			return result
+		}
+
+		cr.apply(entry, vars)
+
+		if cr.rule.Stop {
+			break
+		}
+	}
+
+	return result
+}
+
+// match checks all conditions and returns variables from the regex groups
+func (cr *compiledRule) match(entry *RawLogEntry) (map[string]string, bool) {
+	vars := map[string]string{
+		"logger":  entry.Logger,
+		"host":    entry.Host,
+		"level":   entry.Level,
+		"message": entry.Message,
+	}
+
+	for _, cond := range cr.conditions {
+		value := ruleFieldValue(entry, cond.field)
+
+		var matched bool
+		if cond.regex != nil {
+			groups := cond.regex.FindStringSubmatch(value)
+			matched = groups != nil
+			if matched && !cond.negate {
+				addGroupVars(vars, cond.regex, groups)
+			}
+		} else {
+			matched = cond.glob.Match(value)
+		}
+
+		if matched == cond.negate {
+			return nil, false
+		}
+	}
+
+	for _, ex := range cr.extracts {
+		for k, v := range ex.defaults {
+			vars[k] = v
+		}
+		if groups := ex.regex.FindStringSubmatch(ruleFieldValue(entry, ex.field)); groups != nil {
+			addGroupVars(vars, ex.regex, groups)
+		}
+	}
+
+	return vars, true
+}
+
+// apply rewrites the entry according to the rule
+func (cr *compiledRule) apply(entry *RawLogEntry, vars map[string]string) {
+	expand := func(template string) string {
+		return os.Expand(template, func(key string) string {
+			return vars[key]
+		})
+	}
+
+	if cr.rule.SetLogger != "" {
+		entry.Logger = expand(cr.rule.SetLogger)
+	}
+	if cr.rule.SetHost != "" {
+		entry.Host = expand(cr.rule.SetHost)
+	}
+	if cr.rule.SetLevel != "" {
+		entry.Level = strings.ToUpper(expand(cr.rule.SetLevel))
+	}
+	if len(cr.rule.Labels) > 0 {
+		if entry.Labels == nil {
+			entry.Labels = make(map[string]string, len(cr.rule.Labels))
+		}
+		for k, v := range cr.rule.Labels {
+			entry.Labels[k] = expand(v)
+		}
+	}
+}
+
+// addGroupVars adds the regex groups to the variables: by position ("0" for the whole match, "1" for
+// the first group, used as $1 or ${1}) and named groups by name
+func addGroupVars(vars map[string]string, re *regexp.Regexp, groups []string) {
+	for i, name := range re.SubexpNames() {
+		if i >= len(groups) {
+			break
+		}
+		vars[strconv.Itoa(i)] = groups[i]
+		if name != "" {
+			vars[name] = groups[i]
+		}
+	}
+}
+
+// GetRules returns the currently active rules
+func (e *RuleEngine) GetRules() []IngestRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rules := make([]IngestRule, 0, len(e.rules))
+	for _, cr := range e.rules {
+		rules = append(rules, cr.rule)
+	}
+	return rules
+}
+
+// GetStats returns rule engine statistics
+func (e *RuleEngine) GetStats() map[string]interface{} {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	matched := make(map[string]int64, len(e.matched))
+	for name, n := range e.matched {
+		matched[name] = n
+	}
+
+	source := e.path
+	if source == "" {
+		source = "built-in"
+	}
+
+	return map[string]interface{}{
+		"source":    source,
+		"loaded_at": e.loadedAt.Format(time.RFC3339),
+		"rules":     len(e.rules),
+		"matched":   matched,
+		"dropped":   e.dropped,
+	}
+}
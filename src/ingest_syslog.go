@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syslog frame limits
+const (
+	maxSyslogFrameLength  = 1024 * 1024 // size of a single octet-counted syslog frame
+	maxSyslogLengthDigits = 10          // digits of the length prefix of an octet-counted frame
+)
+
+// syslogSeverityToLevel maps a numeric syslog severity (0-7) to a log level name
+func syslogSeverityToLevel(severity int) string {
+	switch {
+	case severity <= 2: // emergency, alert, critical
+		return "FATAL"
+	case severity == 3:
+		return "ERROR"
+	case severity == 4:
+		return "WARN"
+	case severity <= 6: // notice, informational
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// StartSyslogTCP starts a syslog listener on TCP (octet-counting and newline framing)
+func StartSyslogTCP(addr string, store *LogStatStore, verbose bool) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("Syslog TCP accept error: %v\n", err)
+				return
+			}
+
+			if verbose {
+				log.Printf("=== New syslog connection from %s ===", conn.RemoteAddr())
+			}
+			go handleSyslogConnection(conn, store, verbose)
+		}
+	}()
+
+	return nil
+}
+
+// StartSyslogUDP starts a syslog listener on UDP (one message per datagram)
+func StartSyslogUDP(addr string, store *LogStatStore) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 64*1024)
+		for {
+			n, remote, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Printf("Syslog UDP read error: %v\n", err)
+				return
+			}
+
+			line := strings.TrimRight(string(buf[:n]), "\r\n\x00")
+			store.handleSyslogMessage(line, remote.String())
+		}
+	}()
+
+	return nil
+}
+
+// handleSyslogConnection reads syslog frames from a TCP connection
+func handleSyslogConnection(conn net.Conn, store *LogStatStore, verbose bool) {
+	defer conn.Close()
+
+	remoteAddr := conn.RemoteAddr().String()
+	reader := bufio.NewReaderSize(conn, 64*1024)
+
+	for {
+		frame, err := readSyslogFrame(reader)
+		if frame != "" {
+			store.handleSyslogMessage(frame, remoteAddr)
+		}
+		if err != nil {
+			if err != io.EOF && verbose {
+				log.Printf("Syslog connection error from %s: %v\n", remoteAddr, err)
+			}
+			break
+		}
+	}
+
+	if verbose {
+		log.Printf("Syslog connection closed: %s\n", remoteAddr)
+	}
+}
+
+// readSyslogFrame reads a single frame, detecting octet-counting ("LEN SP MSG", RFC 6587)
+// or newline framing by the first byte of the frame
+func readSyslogFrame(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		// Octet counting, the length prefix is read up to the space but at most maxSyslogLengthDigits digits
+		var lenStr []byte
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			if b == ' ' {
+				break
+			}
+			lenStr = append(lenStr, b)
+			if len(lenStr) > maxSyslogLengthDigits {
+				return "", fmt.Errorf("syslog frame length prefix %q... without space", lenStr)
+			}
+		}
+		n, err := strconv.Atoi(string(lenStr))
+		if err != nil || n < 0 || n > maxSyslogFrameLength {
+			return "", fmt.Errorf("invalid syslog frame length %q", lenStr)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	}
+
+	// Newline framing
+	line, tooLong, err := readLine(reader, maxSyslogFrameLength)
+	if tooLong {
+		return "", fmt.Errorf("syslog line exceeds %d bytes", maxSyslogFrameLength)
+	}
+	return string(line), err
+}
+
+// handleSyslogMessage parses a syslog message and adds it to the store
+func (s *LogStatStore) handleSyslogMessage(line string, remoteAddr string) {
+	if line == "" {
+		return
+	}
+
+	entry, err := parseSyslogMessage(line, time.Now())
+	if err != nil {
+		s.rejected.Add(remoteAddr, line, err)
+		if s.verbose {
+			log.Printf("Rejected syslog message from %s: %v\n", remoteAddr, err)
+		}
+		return
+	}
+
+	// Fall back to the sender address if the message carries no hostname
+	if entry.Host == "" {
+		entry.Host = hostFromRemoteAddr(remoteAddr)
+	}
+	if entry.Logger == "" {
+		entry.Logger = "syslog"
+	}
+
+	s.ingestEntry(entry)
+}
+
+// parseSyslogMessage parses an RFC 5424 or RFC 3164 message into a RawLogEntry
+func parseSyslogMessage(line string, now time.Time) (*RawLogEntry, error) {
+	// PRI: "<" 1*3DIGIT ">"
+	if !strings.HasPrefix(line, "<") {
+		return nil, errors.New("missing syslog PRI")
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return nil, errors.New("invalid syslog PRI")
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri > 191 {
+		return nil, errors.New("invalid syslog PRI")
+	}
+	rest := line[end+1:]
+
+	entry := &RawLogEntry{
+		Level: syslogSeverityToLevel(pri % 8),
+	}
+
+	// RFC 5424 starts with a version number followed by a space
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		err = parseRFC5424(rest[2:], entry)
+	} else {
+		parseRFC3164(rest, entry, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// parseRFC5424 parses "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]"
+func parseRFC5424(rest string, entry *RawLogEntry) error {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return errors.New("incomplete RFC 5424 header")
+	}
+
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp: %w", err)
+		}
+		entry.Timestamp = ts
+	}
+	entry.Host = syslogNilValue(fields[1])
+	entry.Logger = syslogNilValue(fields[2])
+
+	// Skip structured data
+	msg, err := skipStructuredData(fields[5])
+	if err != nil {
+		return err
+	}
+	msg = strings.TrimPrefix(msg, " ")
+	msg = strings.TrimPrefix(msg, "\ufeff") // UTF-8 BOM
+	entry.Message = msg
+
+	return nil
+}
+
+// skipStructuredData returns the remainder after the STRUCTURED-DATA field
+func skipStructuredData(s string) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], nil
+	}
+
+	inQuotes := false
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inQuotes:
+			i++ // skip escaped character
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '[' && !inQuotes:
+			depth++
+		case c == ']' && !inQuotes:
+			depth--
+			// Structured data ends when the next element does not start directly
+			if depth == 0 && (i+1 == len(s) || s[i+1] != '[') {
+				return s[i+1:], nil
+			}
+		case depth == 0:
+			return "", errors.New("invalid RFC 5424 structured data")
+		}
+	}
+	return "", errors.New("unterminated RFC 5424 structured data")
+}
+
+// parseRFC3164 parses "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". Since the format is loosely
+// specified, missing parts are tolerated and the remainder is used as the message.
+func parseRFC3164(rest string, entry *RawLogEntry, now time.Time) {
+	// Timestamp without year, e.g. "Oct 11 22:14:15" or "Oct  1 22:14:15"
+	if len(rest) >= 16 && rest[15] == ' ' {
+		if ts, err := time.ParseInLocation(time.Stamp, rest[:15], now.Location()); err == nil {
+			ts = ts.AddDate(now.Year(), 0, 0)
+			// Messages from the end of last year received in January
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			entry.Timestamp = ts
+			rest = rest[16:]
+
+			// Hostname
+			if idx := strings.IndexByte(rest, ' '); idx > 0 && !strings.ContainsAny(rest[:idx], ":[") {
+				entry.Host = rest[:idx]
+				rest = rest[idx+1:]
+			}
+		}
+	}
+
+	// TAG: alphanumeric up to "[" or ":"
+	if idx := strings.IndexAny(rest, "[: "); idx > 0 && (rest[idx] == '[' || rest[idx] == ':') {
+		entry.Logger = rest[:idx]
+		rest = rest[idx:]
+		if rest[0] == '[' {
+			if closeIdx := strings.IndexByte(rest, ']'); closeIdx > 0 {
+				rest = rest[closeIdx+1:]
+			}
+		}
+		rest = strings.TrimPrefix(rest, ":")
+	}
+
+	entry.Message = strings.TrimPrefix(rest, " ")
+}
+
+// syslogNilValue converts the RFC 5424 NILVALUE "-" to an empty string
+func syslogNilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
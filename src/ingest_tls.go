@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Host identity modes for client certificates
+const (
+	HostIdentityOverride = "override" // replace the self-reported hostName with the certificate CN
+	HostIdentityValidate = "validate" // reject entries whose hostName does not match the certificate CN
+)
+
+// tlsHandshakeTimeout limits the time a client may take to complete the TLS handshake
+const tlsHandshakeTimeout = 10 * time.Second
+
+// loadTLSConfig creates a server TLS configuration. If clientCAFile is given,
+// clients must present a certificate signed by one of the CAs (mutual TLS).
+func loadTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading server certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		caPEM, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no certificates found in client CA bundle")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// tlsPeerIdentity completes the TLS handshake (if conn is a TLS connection) and returns
+// the common name of the verified client certificate ("" for plaintext or no client certificate)
+func tlsPeerIdentity(conn net.Conn) (string, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return "", err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return "", nil
+	}
+	return state.PeerCertificates[0].Subject.CommonName, nil
+}
+
+// applyHostIdentity enforces the trusted host identity from a client certificate on an entry
+func (s *LogStatStore) applyHostIdentity(entry *RawLogEntry, trustedHost string) error {
+	if trustedHost == "" {
+		return nil
+	}
+
+	if s.hostIdentityMode == HostIdentityValidate && entry.Host != "" && !strings.EqualFold(entry.Host, trustedHost) {
+		return fmt.Errorf("hostName %q does not match client certificate CN %q", entry.Host, trustedHost)
+	}
+
+	entry.Host = trustedHost
+	return nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	patternWildcard            = "<*>"                 // template token matching any value
+	patternEmptyTemplate       = "<empty>"             // template of empty messages
+	patternOverflowTemplate    = "<too many patterns>" // catch-all template once a logger has too many patterns
+	patternMaxTokens           = 64                    // messages are truncated to this many tokens
+	patternMaxLineLength       = 1024                  // only the first line (up to this length) is mined
+	patternSimilarity          = 0.5                   // minimum share of matching tokens to join a pattern
+	patternDefaultMaxPerLogger = 200
+)
+
+// Masks applied before tokenizing, most specific first
+var patternMasks = []struct {
+	regex       *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<UUID>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<IP>"},
+	{regexp.MustCompile(`\b0[xX][0-9a-fA-F]+\b|\b[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\b|\b[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\d[0-9a-fA-F]*\b`), "<HEX>"},
+	{regexp.MustCompile(`[-+]?\b\d+([.,]\d+)*[a-zA-Z]*\b`), "<NUM>"}, // including units, e.g. 23ms
+}
+
+// LogPattern is a message template mined from log messages of one logger
+type LogPattern struct {
+	ID          string `json:"pattern_id"`
+	Logger      string `json:"logger"`
+	Template    string `json:"template"`
+	Count       int64  `json:"count"`
+	FirstSeenTS string `json:"first_seen_ts"`
+	LastSeenTS  string `json:"last_seen_ts"`
+
+	tokens []string
+}
+
+// PatternMiner clusters log messages into templates per logger (Drain-style):
+// variable parts (numbers, IDs, UUIDs, IPs) are masked, messages with the same
+// token count are compared position by position, and differing tokens become wildcards.
+type PatternMiner struct {
+	clusters     map[string]map[int][]*LogPattern // logger -> token count -> patterns
+	byID         map[string]*LogPattern
+	perLogger    map[string]int
+	maxPerLogger int
+	dirty        map[string]bool // pattern IDs changed since last TakeDirty
+	mu           sync.Mutex
+}
+
+// NewPatternMiner creates a miner keeping at most maxPerLogger patterns per logger
+func NewPatternMiner(maxPerLogger int) *PatternMiner {
+	if maxPerLogger <= 0 {
+		maxPerLogger = patternDefaultMaxPerLogger
+	}
+	return &PatternMiner{
+		clusters:     make(map[string]map[int][]*LogPattern),
+		byID:         make(map[string]*LogPattern),
+		perLogger:    make(map[string]int),
+		maxPerLogger: maxPerLogger,
+		dirty:        make(map[string]bool),
+	}
+}
+
+// tokenizeMessage masks variable parts of the first message line and splits it into tokens
+func tokenizeMessage(message string) []string {
+	line := message
+	if idx := strings.IndexAny(line, "\r\n"); idx >= 0 {
+		line = line[:idx]
+	}
+	if len(line) > patternMaxLineLength {
+		line = line[:patternMaxLineLength]
+	}
+
+	for _, mask := range patternMasks {
+		line = mask.regex.ReplaceAllString(line, mask.replacement)
+	}
+
+	tokens := strings.Fields(line)
+	if len(tokens) > patternMaxTokens {
+		tokens = tokens[:patternMaxTokens]
+	}
+	return tokens
+}
+
+// patternID derives a stable ID from logger and the initial template
+func patternID(logger, template string) string {
+	hash := sha256.Sum256([]byte(logger + "\x00" + template))
+	return hex.EncodeToString(hash[:6])
+}
+
+// similarity returns the share of positions where the pattern matches the tokens
+func (p *LogPattern) similarity(tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 1
+	}
+	same := 0
+	for i, token := range tokens {
+		if p.tokens[i] == token || p.tokens[i] == patternWildcard {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens))
+}
+
+// merge generalizes the pattern so it also covers the tokens, returns true if the template changed
+func (p *LogPattern) merge(tokens []string) bool {
+	changed := false
+	for i, token := range tokens {
+		if p.tokens[i] != token && p.tokens[i] != patternWildcard {
+			p.tokens[i] = patternWildcard
+			changed = true
+		}
+	}
+	if changed {
+		p.Template = strings.Join(p.tokens, " ")
+	}
+	return changed
+}
+
+// Match finds or creates the pattern for a message and returns its ID
+func (m *PatternMiner) Match(logger, message string, ts time.Time) string {
+	tokens := tokenizeMessage(message)
+	tsStr := ts.Format(time.RFC3339)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byLen, exists := m.clusters[logger]
+	if !exists {
+		byLen = make(map[int][]*LogPattern)
+		m.clusters[logger] = byLen
+	}
+
+	// Find most similar pattern with the same token count
+	var best *LogPattern
+	bestSim := -1.0
+	for _, p := range byLen[len(tokens)] {
+		if sim := p.similarity(tokens); sim > bestSim {
+			best, bestSim = p, sim
+		}
+	}
+
+	if best != nil && bestSim >= patternSimilarity {
+		best.merge(tokens)
+	} else if m.perLogger[logger] >= m.maxPerLogger {
+		best = m.overflowPattern(logger, tsStr)
+	} else {
+		template := strings.Join(tokens, " ")
+		if template == "" {
+			template = patternEmptyTemplate
+		}
+		best = &LogPattern{
+			ID:          patternID(logger, template),
+			Logger:      logger,
+			Template:    template,
+			FirstSeenTS: tsStr,
+			tokens:      tokens,
+		}
+		byLen[len(tokens)] = append(byLen[len(tokens)], best)
+		m.byID[best.ID] = best
+		m.perLogger[logger]++
+	}
+
+	best.Count++
+	if best.LastSeenTS < tsStr {
+		best.LastSeenTS = tsStr
+	}
+	if best.FirstSeenTS == "" || tsStr < best.FirstSeenTS {
+		best.FirstSeenTS = tsStr
+	}
+	m.dirty[best.ID] = true
+
+	return best.ID
+}
+
+// overflowPattern returns the catch-all pattern for a logger that has too many patterns
+func (m *PatternMiner) overflowPattern(logger, tsStr string) *LogPattern {
+	id := patternID(logger, patternOverflowTemplate)
+	if p, exists := m.byID[id]; exists {
+		return p
+	}
+	p := &LogPattern{
+		ID:          id,
+		Logger:      logger,
+		Template:    patternOverflowTemplate,
+		FirstSeenTS: tsStr,
+	}
+	m.byID[id] = p
+	return p
+}
+
+// Restore adds a previously persisted pattern (e.g. loaded from the database on startup)
+func (m *PatternMiner) Restore(p *LogPattern) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.byID[p.ID]; exists {
+		return
+	}
+
+	m.byID[p.ID] = p
+	if p.Template == patternOverflowTemplate {
+		return
+	}
+
+	if p.Template != patternEmptyTemplate {
+		p.tokens = strings.Fields(p.Template)
+	}
+	byLen, exists := m.clusters[p.Logger]
+	if !exists {
+		byLen = make(map[int][]*LogPattern)
+		m.clusters[p.Logger] = byLen
+	}
+	byLen[len(p.tokens)] = append(byLen[len(p.tokens)], p)
+	m.perLogger[p.Logger]++
+}
+
+// Get returns a copy of a pattern by ID
+func (m *PatternMiner) Get(id string) (*LogPattern, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, exists := m.byID[id]
+	if !exists {
+		return nil, false
+	}
+	patternCopy := *p
+	patternCopy.tokens = nil
+	return &patternCopy, true
+}
+
+// TakeDirty returns copies of all patterns changed since the last call and resets the change set
+func (m *PatternMiner) TakeDirty() []*LogPattern {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]*LogPattern, 0, len(m.dirty))
+	for id := range m.dirty {
+		patternCopy := *m.byID[id]
+		patternCopy.tokens = nil
+		result = append(result, &patternCopy)
+	}
+	m.dirty = make(map[string]bool)
+	return result
+}
+
+// MarkDirty re-marks patterns as changed (e.g. after a failed flush)
+func (m *PatternMiner) MarkDirty(patterns []*LogPattern) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range patterns {
+		m.dirty[p.ID] = true
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// PatternSummary represents the occurrences of a message pattern within a query range
+type PatternSummary struct {
+	PatternID   string `json:"pattern_id"`
+	Logger      string `json:"logger"`
+	Template    string `json:"template"`
+	TotalCount  int    `json:"total_count"`
+	HostCount   int    `json:"host_count"`
+	FirstSeenTS string `json:"first_seen_ts"`
+	LastBucket  string `json:"last_bucket_ts"`
+}
+
+// PatternBucketStat represents the count of a message pattern in a time bucket (summed over hosts)
+type PatternBucketStat struct {
+	BucketTS   string `json:"bucket_ts"`
+	PatternID  string `json:"pattern_id"`
+	Logger     string `json:"logger"`
+	Level      string `json:"level"`
+	TotalCount int    `json:"total_count"`
+}
+
+// EnablePatternMining enables message pattern mining and restores known patterns from the database
+func (s *LogStatStore) EnablePatternMining(maxPerLogger int) error {
+	miner := NewPatternMiner(maxPerLogger)
+
+	rows, err := s.db.Query("SELECT pattern_id, logger, template, total_count, first_seen_ts, last_seen_ts FROM log_patterns")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &LogPattern{}
+		if err := rows.Scan(&p.ID, &p.Logger, &p.Template, &p.Count, &p.FirstSeenTS, &p.LastSeenTS); err != nil {
+			log.Printf("Error scanning pattern row: %v\n", err)
+			continue
+		}
+		miner.Restore(p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.patterns = miner
+	s.mu.Unlock()
+
+	return nil
+}
+
+// addPatternStat counts an entry (with assigned pattern) in the pattern stats of a bucket
+func (s *LogStatStore) addPatternStat(entry *RawLogEntry, bucketTS string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seenTS := entry.Timestamp.Local().Format(time.RFC3339)
+	key := entry.Host + ":" + entry.Logger + ":" + entry.Level + ":" + entry.PatternID + ":" + bucketTS
+
+	if stat, exists := s.patternEntries[key]; exists {
+		stat.N++
+		if seenTS < stat.FirstSeenTS {
+			stat.FirstSeenTS = seenTS
+		}
+		return
+	}
+
+	s.patternEntries[key] = &PatternStat{
+		HostName:    entry.Host,
+		BucketTS:    bucketTS,
+		Level:       entry.Level,
+		Logger:      entry.Logger,
+		PatternID:   entry.PatternID,
+		N:           1,
+		FirstSeenTS: seenTS,
+	}
+}
+
+// flushPatterns writes the pattern stats and changed patterns of a flush batch within the flush transaction
+func (s *LogStatStore) flushPatterns(tx *sql.Tx, batch *flushBatch) error {
+	if s.patterns == nil {
+		return nil
+	}
+
+	statSQL := `
+	INSERT INTO log_pattern_stats (hostname, bucket_ts, level, logger, pattern_id, n, first_seen_ts)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(hostname, bucket_ts, level, logger, pattern_id)
+	DO UPDATE SET
+		n = log_pattern_stats.n + excluded.n,
+		first_seen_ts = MIN(log_pattern_stats.first_seen_ts, excluded.first_seen_ts);
+	`
+	statStmt, err := tx.Prepare(statSQL)
+	if err != nil {
+		return err
+	}
+	defer statStmt.Close()
+
+	for _, stat := range batch.patternEntries {
+		if _, err := statStmt.Exec(stat.HostName, stat.BucketTS, stat.Level, stat.Logger, stat.PatternID, stat.N, stat.FirstSeenTS); err != nil {
+			return fmt.Errorf("upserting pattern stat: %w", err)
+		}
+	}
+
+	patternSQL := `
+	INSERT INTO log_patterns (pattern_id, logger, template, total_count, first_seen_ts, last_seen_ts)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(pattern_id)
+	DO UPDATE SET
+		template = excluded.template,
+		total_count = excluded.total_count,
+		first_seen_ts = MIN(log_patterns.first_seen_ts, excluded.first_seen_ts),
+		last_seen_ts = MAX(log_patterns.last_seen_ts, excluded.last_seen_ts);
+	`
+	patternStmt, err := tx.Prepare(patternSQL)
+	if err != nil {
+		return err
+	}
+	defer patternStmt.Close()
+
+	for _, p := range batch.dirtyPatterns {
+		if _, err := patternStmt.Exec(p.ID, p.Logger, p.Template, p.Count, p.FirstSeenTS, p.LastSeenTS); err != nil {
+			return fmt.Errorf("upserting pattern: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// QueryPatterns returns the patterns matching the filter with their counts in the query range,
+// most frequent first
+func (s *LogStatStore) QueryPatterns(filter QueryFilter) ([]*PatternSummary, error) {
+	loggerRegex, err := compileLoggerRegex(filter.LoggerRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	summaryMap := make(map[string]*PatternSummary)
+	hosts := make(map[string]map[string]bool)
+
+	addStat := func(patternID, logger, template, hostName, bucketTS, firstSeenTS string, n int) {
+		summary, exists := summaryMap[patternID]
+		if !exists {
+			summary = &PatternSummary{PatternID: patternID, Logger: logger, Template: template}
+			summaryMap[patternID] = summary
+			hosts[patternID] = make(map[string]bool)
+		}
+		summary.TotalCount += n
+		if summary.Template == "" {
+			summary.Template = template
+		}
+		if firstSeenTS != "" && (summary.FirstSeenTS == "" || firstSeenTS < summary.FirstSeenTS) {
+			summary.FirstSeenTS = firstSeenTS
+		}
+		if bucketTS > summary.LastBucket {
+			summary.LastBucket = bucketTS
+		}
+		hosts[patternID][hostName] = true
+	}
+
+	if filter.IncludeMemory {
+		for _, stat := range s.patternStatsFromMemory(filter, loggerRegex) {
+			addStat(stat.PatternID, stat.Logger, "", stat.HostName, stat.BucketTS, stat.FirstSeenTS, stat.N)
+		}
+	}
+
+	if filter.IncludeDB {
+		if err := s.queryPatternsFromDB(filter, addStat); err != nil {
+			log.Printf("Error querying patterns from database: %v\n", err)
+		}
+	}
+
+	results := make([]*PatternSummary, 0, len(summaryMap))
+	for id, summary := range summaryMap {
+		summary.HostCount = len(hosts[id])
+		if s.patterns != nil {
+			if p, ok := s.patterns.Get(id); ok {
+				summary.Template = p.Template
+			}
+		}
+		results = append(results, summary)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].TotalCount != results[j].TotalCount {
+			return results[i].TotalCount > results[j].TotalCount
+		}
+		return results[i].PatternID < results[j].PatternID
+	})
+
+	if filter.MaxResults > 0 && len(results) > filter.MaxResults {
+		results = results[:filter.MaxResults]
+	}
+
+	return results, nil
+}
+
+// QueryPatternTimeline returns pattern counts per bucket, summed over hosts, newest bucket first
+func (s *LogStatStore) QueryPatternTimeline(filter QueryFilter) ([]*PatternBucketStat, error) {
+	loggerRegex, err := compileLoggerRegex(filter.LoggerRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pattern stats are kept at the primary bucket size, coarser sizes are rebucketed
+	bucketSize, err := s.coarserBucketSize(filter.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	timelineMap := make(map[string]*PatternBucketStat)
+	addStat := func(stat *PatternBucketStat) {
+		if bucketSize != s.bucketSize {
+			if bucketTime, err := time.Parse(time.RFC3339, stat.BucketTS); err == nil {
+				stat.BucketTS = getBucketTime(bucketTime.Local(), bucketSize).Format(time.RFC3339)
+			}
+		}
+		key := stat.BucketTS + ":" + stat.PatternID + ":" + stat.Level
+		if existing, exists := timelineMap[key]; exists {
+			existing.TotalCount += stat.TotalCount
+		} else {
+			timelineMap[key] = stat
+		}
+	}
+
+	if filter.IncludeMemory {
+		for _, stat := range s.patternStatsFromMemory(filter, loggerRegex) {
+			addStat(&PatternBucketStat{
+				BucketTS:   stat.BucketTS,
+				PatternID:  stat.PatternID,
+				Logger:     stat.Logger,
+				Level:      stat.Level,
+				TotalCount: stat.N,
+			})
+		}
+	}
+
+	if filter.IncludeDB {
+		dbStats, err := s.queryPatternTimelineFromDB(filter)
+		if err != nil {
+			log.Printf("Error querying pattern timeline from database: %v\n", err)
+		}
+		for _, stat := range dbStats {
+			addStat(stat)
+		}
+	}
+
+	results := make([]*PatternBucketStat, 0, len(timelineMap))
+	for _, stat := range timelineMap {
+		results = append(results, stat)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].BucketTS != results[j].BucketTS {
+			return results[i].BucketTS > results[j].BucketTS
+		}
+		return results[i].TotalCount > results[j].TotalCount
+	})
+
+	if filter.MaxResults > 0 && len(results) > filter.MaxResults {
+		results = results[:filter.MaxResults]
+	}
+
+	return results, nil
+}
+
+// coarserBucketSize resolves a bucket parameter for stats kept only at the primary bucket size.
+// Sizes must be multiples of the primary bucket size.
+func (s *LogStatStore) coarserBucketSize(resolution string) (time.Duration, error) {
+	switch resolution {
+	case "", "auto", "raw":
+		return s.bucketSize, nil
+	}
+
+	size, err := time.ParseDuration(resolution)
+	if err != nil {
+		size = 0
+		for _, tier := range s.rollupTiers {
+			if tier.Name == resolution {
+				size = tier.BucketSize
+			}
+		}
+	}
+	if size < s.bucketSize || size%s.bucketSize != 0 {
+		return 0, fmt.Errorf("unknown bucket resolution %q (must be a multiple of %v)", resolution, s.bucketSize)
+	}
+	return size, nil
+}
+
+// patternStatsFromMemory returns copies of the in-memory pattern stats matching the filter
+func (s *LogStatStore) patternStatsFromMemory(filter QueryFilter, loggerRegex *regexp.Regexp) []*PatternStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats []*PatternStat
+	for _, entries := range s.pendingPatternEntries() {
+		for _, stat := range entries {
+			if filter.Level != "" && stat.Level != filter.Level {
+				continue
+			}
+			if filter.PatternID != "" && stat.PatternID != filter.PatternID {
+				continue
+			}
+			if loggerRegex != nil && !loggerRegex.MatchString(stat.Logger) {
+				continue
+			}
+			if (!filter.StartTime.IsZero() || !filter.EndTime.IsZero()) && !bucketInRange(stat.BucketTS, filter) {
+				continue
+			}
+			statCopy := *stat
+			stats = append(stats, &statCopy)
+		}
+	}
+	return stats
+}
+
+// bucketInRange reports whether a bucket timestamp lies within the time range of the filter
+func bucketInRange(bucketTS string, filter QueryFilter) bool {
+	bucketTime, err := time.Parse(time.RFC3339, bucketTS)
+	if err != nil {
+		return false
+	}
+	if !filter.StartTime.IsZero() && bucketTime.Before(filter.StartTime) {
+		return false
+	}
+	if !filter.EndTime.IsZero() && bucketTime.After(filter.EndTime) {
+		return false
+	}
+	return true
+}
+
+// compileLoggerRegex compiles the logger filter regex (nil if empty)
+func compileLoggerRegex(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// patternWhereClause builds the SQL filter conditions for the pattern stats table
+func patternWhereClause(filter QueryFilter) (string, []interface{}) {
+	where := " WHERE 1=1"
+	var args []interface{}
+
+	if filter.Level != "" {
+		where += " AND ps.level = ?"
+		args = append(args, filter.Level)
+	}
+
+	if filter.PatternID != "" {
+		where += " AND ps.pattern_id = ?"
+		args = append(args, filter.PatternID)
+	}
+
+	if filter.LoggerRegex != "" {
+		condition, regexArgs := regexCondition("ps.logger", filter.LoggerRegex)
+		where += condition
+		args = append(args, regexArgs...)
+	}
+
+	if !filter.StartTime.IsZero() {
+		where += " AND ps.bucket_ts >= ?"
+		args = append(args, filter.StartTime.Format(time.RFC3339))
+	}
+
+	if !filter.EndTime.IsZero() {
+		where += " AND ps.bucket_ts <= ?"
+		args = append(args, filter.EndTime.Format(time.RFC3339))
+	}
+
+	return where, args
+}
+
+// queryPatternsFromDB aggregates pattern stats per pattern and host using SQL GROUP BY
+func (s *LogStatStore) queryPatternsFromDB(filter QueryFilter, add func(patternID, logger, template, hostName, bucketTS, firstSeenTS string, n int)) error {
+	where, args := patternWhereClause(filter)
+	query := `
+		SELECT
+			ps.pattern_id,
+			ps.logger,
+			COALESCE(p.template, ''),
+			ps.hostname,
+			MAX(ps.bucket_ts),
+			MIN(ps.first_seen_ts),
+			SUM(ps.n)
+		FROM log_pattern_stats ps
+		LEFT JOIN log_patterns p ON p.pattern_id = ps.pattern_id
+	` + where + " GROUP BY ps.pattern_id, ps.logger, ps.hostname"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var patternID, logger, template, hostName, lastBucket, firstSeenTS string
+		var n int
+		if err := rows.Scan(&patternID, &logger, &template, &hostName, &lastBucket, &firstSeenTS, &n); err != nil {
+			log.Printf("Error scanning pattern row: %v\n", err)
+			continue
+		}
+		add(patternID, logger, template, hostName, lastBucket, firstSeenTS, n)
+	}
+
+	return rows.Err()
+}
+
+// queryPatternTimelineFromDB aggregates pattern stats per bucket using SQL GROUP BY
+func (s *LogStatStore) queryPatternTimelineFromDB(filter QueryFilter) ([]*PatternBucketStat, error) {
+	where, args := patternWhereClause(filter)
+	query := `
+		SELECT ps.bucket_ts, ps.pattern_id, ps.logger, ps.level, SUM(ps.n) as total_count
+		FROM log_pattern_stats ps
+	` + where + " GROUP BY ps.bucket_ts, ps.pattern_id, ps.logger, ps.level ORDER BY ps.bucket_ts DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*PatternBucketStat
+	for rows.Next() {
+		stat := &PatternBucketStat{}
+		if err := rows.Scan(&stat.BucketTS, &stat.PatternID, &stat.Logger, &stat.Level, &stat.TotalCount); err != nil {
+			log.Printf("Error scanning pattern timeline row: %v\n", err)
+			continue
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
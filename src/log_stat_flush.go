@@ -0,0 +1,266 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Flush retry policy: attempts per flush with doubling backoff before the batch is merged back
+const (
+	flushRetryAttempts = 3
+	flushRetryBackoff  = 1 * time.Second
+)
+
+// flushBatch holds the in-memory data detached from the store for one flush
+type flushBatch struct {
+	entries          map[string]*LogStat
+	patternEntries   map[string]*PatternStat
+	dirtyPatterns    []*LogPattern
+	stackTraces      map[string]*StackTraceInfo
+	exceptionEntries map[string]*ExceptionStat
+	searchDocs       []*searchDoc
+	journalSegments  []string            // journal segments holding the records of this batch
+	catalogEntries   map[string]*LogStat // buckets of earlier batches in the stats backend, not yet in the catalog totals
+	statsWritten     bool                // entries written to the stats backend (not repeated on retry), guarded by s.mu
+
+	searchDimensions map[string]map[string]int64 // dimension IDs resolved by the search index flush
+	searchIndexed    int                         // messages written by the search index flush
+}
+
+// FlushStats holds flush metrics
+type FlushStats struct {
+	Flushes        int64  // successful flushes
+	Failures       int64  // failed flush attempts
+	Requeued       int64  // batches merged back after all attempts failed
+	LastEntries    int    // entries written by the last successful flush
+	LastDurationMs int64  // duration of the last successful flush (including retries)
+	MaxDurationMs  int64  // longest successful flush
+	LastFlushTS    string // time of the last successful flush
+	LastError      string // error of the last failed attempt
+	LastErrorTS    string // time of the last failed attempt
+}
+
+// takeFlushBatch detaches the in-memory data from the store, ingestion continues into fresh maps
+func (s *LogStatStore) takeFlushBatch() *flushBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := &flushBatch{
+		entries:          s.entries,
+		patternEntries:   s.patternEntries,
+		stackTraces:      s.stackTraces,
+		exceptionEntries: s.exceptionEntries,
+		searchDocs:       s.searchDocs,
+		journalSegments:  s.journalSegments,
+		catalogEntries:   s.catalogEntries,
+	}
+	s.entries = make(map[string]*LogStat)
+	s.catalogEntries = make(map[string]*LogStat)
+	s.patternEntries = make(map[string]*PatternStat)
+	s.stackTraces = make(map[string]*StackTraceInfo)
+	s.exceptionEntries = make(map[string]*ExceptionStat)
+	s.searchDocs = nil
+	s.journalSegments = nil
+
+	if s.patterns != nil {
+		batch.dirtyPatterns = s.patterns.TakeDirty()
+	}
+
+	// Records of entries ingested from now on go to a new journal file
+	if s.journal != nil {
+		segment, err := s.journal.Rotate()
+		if err != nil {
+			log.Printf("Error rotating journal: %v\n", err)
+		}
+		if segment != "" {
+			batch.journalSegments = append(batch.journalSegments, segment)
+		}
+	}
+
+	s.flushInFlight = batch
+	return batch
+}
+
+// mergeFlushBatch merges the data of a failed flush back into the store for the next flush
+func (s *LogStatStore) mergeFlushBatch(batch *flushBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Buckets already in the stats backend are not merged back (their journal segments are removed),
+	// only their catalog totals are still to be written
+	if batch.statsWritten {
+		mergeLogStats(s.catalogEntries, batch.entries)
+	} else {
+		mergeLogStats(s.entries, batch.entries)
+	}
+	mergeLogStats(s.catalogEntries, batch.catalogEntries)
+
+	for key, stat := range batch.patternEntries {
+		if existing, exists := s.patternEntries[key]; exists {
+			existing.N += stat.N
+			if stat.FirstSeenTS < existing.FirstSeenTS {
+				existing.FirstSeenTS = stat.FirstSeenTS
+			}
+		} else {
+			s.patternEntries[key] = stat
+		}
+	}
+
+	for key, stat := range batch.exceptionEntries {
+		if existing, exists := s.exceptionEntries[key]; exists {
+			existing.N += stat.N
+		} else {
+			s.exceptionEntries[key] = stat
+		}
+	}
+
+	for fingerprint, info := range batch.stackTraces {
+		if existing, exists := s.stackTraces[fingerprint]; exists {
+			existing.Count += info.Count
+			if info.FirstSeenTS < existing.FirstSeenTS {
+				existing.FirstSeenTS = info.FirstSeenTS
+			}
+			if info.LastSeenTS > existing.LastSeenTS {
+				existing.LastSeenTS = info.LastSeenTS
+			}
+			existing.SampleTrace = info.SampleTrace
+		} else {
+			s.stackTraces[fingerprint] = info
+		}
+	}
+
+	if s.patterns != nil {
+		s.patterns.MarkDirty(batch.dirtyPatterns)
+	}
+
+	// Queued search messages go first, the queue limit still applies
+	if len(batch.searchDocs) > 0 {
+		docs := append(batch.searchDocs, s.searchDocs...)
+		if len(docs) > searchMaxPending {
+			s.search.dropped += int64(len(docs) - searchMaxPending)
+			docs = docs[:searchMaxPending]
+		}
+		s.searchDocs = docs
+	}
+
+	s.journalSegments = append(batch.journalSegments, s.journalSegments...)
+	s.flushInFlight = nil
+	s.flushStats.Requeued++
+}
+
+// mergeLogStats adds the buckets of src to dst: n is summed, first_seen_ts keeps the minimum
+func mergeLogStats(dst, src map[string]*LogStat) {
+	for key, stat := range src {
+		if existing, exists := dst[key]; exists {
+			existing.N += stat.N
+			if stat.FirstSeenTS != "" && (existing.FirstSeenTS == "" || stat.FirstSeenTS < existing.FirstSeenTS) {
+				existing.FirstSeenTS = stat.FirstSeenTS
+			}
+		} else {
+			dst[key] = stat
+		}
+	}
+}
+
+// markStatsWritten records that the entries of a batch are in the stats backend, queries read them
+// from there from now on
+func (s *LogStatStore) markStatsWritten(batch *flushBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch.statsWritten = true
+}
+
+// commitFlushBatch detaches a batch whose transaction committed, its data is read from the database
+// from now on
+func (s *LogStatStore) commitFlushBatch(batch *flushBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.flushInFlight == batch {
+		s.flushInFlight = nil
+	}
+}
+
+// pendingEntries returns the bucket maps not yet in the stats backend: the store's entries and those
+// of the batch being flushed until they are written. Callers hold s.mu.
+func (s *LogStatStore) pendingEntries() []map[string]*LogStat {
+	if s.flushInFlight != nil && !s.flushInFlight.statsWritten {
+		return []map[string]*LogStat{s.entries, s.flushInFlight.entries}
+	}
+	return []map[string]*LogStat{s.entries}
+}
+
+// pendingPatternEntries returns the pattern stat maps not yet committed. Callers hold s.mu.
+func (s *LogStatStore) pendingPatternEntries() []map[string]*PatternStat {
+	if s.flushInFlight != nil {
+		return []map[string]*PatternStat{s.patternEntries, s.flushInFlight.patternEntries}
+	}
+	return []map[string]*PatternStat{s.patternEntries}
+}
+
+// pendingExceptionEntries returns the exception stat maps not yet committed. Callers hold s.mu.
+func (s *LogStatStore) pendingExceptionEntries() []map[string]*ExceptionStat {
+	if s.flushInFlight != nil {
+		return []map[string]*ExceptionStat{s.exceptionEntries, s.flushInFlight.exceptionEntries}
+	}
+	return []map[string]*ExceptionStat{s.exceptionEntries}
+}
+
+// pendingStackTraces returns the fingerprint maps not yet committed. Callers hold s.mu.
+func (s *LogStatStore) pendingStackTraces() []map[string]*StackTraceInfo {
+	if s.flushInFlight != nil {
+		return []map[string]*StackTraceInfo{s.stackTraces, s.flushInFlight.stackTraces}
+	}
+	return []map[string]*StackTraceInfo{s.stackTraces}
+}
+
+// recordFlushFailure counts a failed flush attempt
+func (s *LogStatStore) recordFlushFailure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushStats.Failures++
+	s.flushStats.LastError = err.Error()
+	s.flushStats.LastErrorTS = time.Now().Format(time.RFC3339)
+}
+
+// recordFlushSuccess updates the metrics after a successful flush
+func (s *LogStatStore) recordFlushSuccess(entries int, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushStats.Flushes++
+	s.flushStats.LastEntries = entries
+	s.flushStats.LastDurationMs = duration.Milliseconds()
+	if s.flushStats.LastDurationMs > s.flushStats.MaxDurationMs {
+		s.flushStats.MaxDurationMs = s.flushStats.LastDurationMs
+	}
+	s.flushStats.LastFlushTS = time.Now().Format(time.RFC3339)
+}
+
+// GetFlushStats returns the flush metrics with the current backlog
+func (s *LogStatStore) GetFlushStats() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inFlight := 0
+	if s.flushInFlight != nil && !s.flushInFlight.statsWritten {
+		inFlight = len(s.flushInFlight.entries)
+	}
+
+	return map[string]interface{}{
+		"flushes":          s.flushStats.Flushes,
+		"failures":         s.flushStats.Failures,
+		"requeued":         s.flushStats.Requeued,
+		"last_entries":     s.flushStats.LastEntries,
+		"last_duration_ms": s.flushStats.LastDurationMs,
+		"max_duration_ms":  s.flushStats.MaxDurationMs,
+		"last_flush_ts":    s.flushStats.LastFlushTS,
+		"last_error":       s.flushStats.LastError,
+		"last_error_ts":    s.flushStats.LastErrorTS,
+		"backlog_entries":  len(s.entries) + inFlight, // not yet in the database
+		"pending_entries":  len(s.entries),
+		"inflight_entries": inFlight,
+	}
+}
@@ -2,65 +2,161 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"regexp"
-	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-// regexToLike converts a simple regex pattern to SQL LIKE pattern
-func regexToLike(pattern string) string {
-	if pattern == "" {
-		return "%"
-	}
+// QueryFilter holds filter criteria for querying log statistics
+type QueryFilter struct {
+	Level         string    // Filter by log level (empty = all levels)
+	LoggerRegex   string    // Regex pattern to match logger names (empty = all loggers)
+	StartTime     time.Time // Filter entries >= this time (zero = no start limit)
+	EndTime       time.Time // Filter entries <= this time (zero = no end limit)
+	MaxResults    int       // Maximum number of results to return (0 = unlimited)
+	IncludeMemory bool      // Include in-memory entries
+	IncludeDB     bool      // Include database entries
+	PatternID     string    // Filter by message pattern ID (pattern queries only)
+	Resolution    string    // Bucket size ("15m"), "raw" (primary bucket size), a rollup tier name ("hourly", "daily") or "" to pick by time range
 
-	// Check for anchored patterns
-	hasStart := strings.HasPrefix(pattern, "^")
-	hasEnd := strings.HasSuffix(pattern, "$")
+	Dimensions DimensionFilter // multi-value and exclusion filters (stats and aggregated queries)
+}
+
+// queryResolution is the bucket resolution a query is served at
+type queryResolution struct {
+	sourceSize int         // bucket_size_s of the log_stats rows (and memory entries) used
+	tier       *RollupTier // rollup tier the source rows are rebucketed to (nil = source buckets as is)
+}
+
+// bucketSize returns the bucket size of the query results
+func (r queryResolution) bucketSize() time.Duration {
+	if r.tier != nil {
+		return r.tier.BucketSize
+	}
+	return time.Duration(r.sourceSize) * time.Second
+}
 
-	// Remove anchors
-	if hasStart {
-		pattern = strings.TrimPrefix(pattern, "^")
+// name returns the resolution as a QueryFilter.Resolution value (bucket size or tier name)
+func (r queryResolution) name() string {
+	if r.tier != nil {
+		return r.tier.Name
 	}
-	if hasEnd {
-		pattern = strings.TrimSuffix(pattern, "$")
+	return (time.Duration(r.sourceSize) * time.Second).String()
+}
+
+// statsSegment is the part of a query served by one stats table
+type statsSegment struct {
+	table      string
+	bucketSize int    // bucket_size_s of the rows (0 = rollup table without sizes)
+	from       string // inclusive bucket_ts lower bound ("" = none)
+	before     string // exclusive bucket_ts upper bound ("" = none)
+}
+
+// pickResolution returns the resolution used for a query. Without an explicit resolution the finest
+// bucket size whose retention covers the start time is used, then the rollup tiers.
+func (s *LogStatStore) pickResolution(filter QueryFilter) (queryResolution, error) {
+	primary := queryResolution{sourceSize: int(s.bucketSize.Seconds())}
+	rollupSource := int(finestResolution(s.resolutions).Size.Seconds())
+
+	switch filter.Resolution {
+	case "", "auto":
+	case "raw":
+		return primary, nil
+	default:
+		for i := range s.rollupTiers {
+			if s.rollupTiers[i].Name == filter.Resolution {
+				return queryResolution{sourceSize: rollupSource, tier: &s.rollupTiers[i]}, nil
+			}
+		}
+		if size, err := time.ParseDuration(filter.Resolution); err == nil {
+			for _, res := range s.resolutions {
+				if res.Size == size {
+					return queryResolution{sourceSize: int(size.Seconds())}, nil
+				}
+			}
+			for i := range s.rollupTiers {
+				if s.rollupTiers[i].BucketSize == size {
+					return queryResolution{sourceSize: rollupSource, tier: &s.rollupTiers[i]}, nil
+				}
+			}
+		}
+		return primary, fmt.Errorf("%w: unknown bucket resolution %q", errInvalidQuery, filter.Resolution)
 	}
 
-	// Replace regex patterns with LIKE wildcards
-	pattern = strings.ReplaceAll(pattern, ".*", "%")
-	pattern = strings.ReplaceAll(pattern, "\\.", ".") // Unescape dots
+	if filter.StartTime.IsZero() {
+		return primary, nil
+	}
 
-	// Add wildcards based on anchors
-	if !hasStart && !hasEnd {
-		// No anchors - match anywhere
-		pattern = "%" + pattern + "%"
-	} else if hasStart && !hasEnd {
-		// Start anchor only - starts with
-		if !strings.HasSuffix(pattern, "%") {
-			pattern = pattern + "%"
+	// Finest bucket size still retained at the start time
+	age := time.Since(filter.StartTime)
+	var best *BucketResolution
+	for i, res := range s.resolutions {
+		if age <= time.Duration(res.RetentionDays)*24*time.Hour && (best == nil || res.Size < best.Size) {
+			best = &s.resolutions[i]
 		}
-	} else if !hasStart && hasEnd {
-		// End anchor only - ends with
-		if !strings.HasPrefix(pattern, "%") {
-			pattern = "%" + pattern
+	}
+	if best != nil {
+		return queryResolution{sourceSize: int(best.Size.Seconds())}, nil
+	}
+
+	for i := range s.rollupTiers {
+		if age <= time.Duration(s.rollupTiers[i].RetentionDays)*24*time.Hour {
+			return queryResolution{sourceSize: rollupSource, tier: &s.rollupTiers[i]}, nil
 		}
 	}
-	// else both anchors - exact match, use pattern as-is
+	if len(s.rollupTiers) > 0 {
+		return queryResolution{sourceSize: rollupSource, tier: &s.rollupTiers[len(s.rollupTiers)-1]}, nil
+	}
 
-	return pattern
+	// No rollups: the bucket size with the longest retention
+	longest := s.resolutions[0]
+	for _, res := range s.resolutions[1:] {
+		if res.RetentionDays > longest.RetentionDays {
+			longest = res
+		}
+	}
+	return queryResolution{sourceSize: int(longest.Size.Seconds())}, nil
 }
 
-// QueryFilter holds filter criteria for querying log statistics
-type QueryFilter struct {
-	Level         string    // Filter by log level (empty = all levels)
-	LoggerRegex   string    // Regex pattern to match logger names (empty = all loggers)
-	StartTime     time.Time // Filter entries >= this time (zero = no start limit)
-	EndTime       time.Time // Filter entries <= this time (zero = no end limit)
-	MaxResults    int       // Maximum number of results to return (0 = unlimited)
-	IncludeMemory bool      // Include in-memory entries
-	IncludeDB     bool      // Include database entries
+// querySegments splits a query at the given resolution into table segments: the tier table up to its
+// rollup watermark, then each finer table from the coarser watermark on (rebucketed by the caller)
+func (s *LogStatStore) querySegments(res queryResolution) []statsSegment {
+	source := statsSegment{table: "log_stats", bucketSize: res.sourceSize}
+	if res.tier == nil {
+		return []statsSegment{source}
+	}
+
+	watermarks, err := getRollupWatermarks(s.db)
+	if err != nil {
+		log.Printf("Error reading rollup state: %v\n", err)
+		return []statsSegment{source}
+	}
+
+	// Tiers from the requested one down to the finest
+	var tables []string
+	for i := len(s.rollupTiers) - 1; i >= 0; i-- {
+		if len(tables) > 0 || s.rollupTiers[i].Table == res.tier.Table {
+			tables = append(tables, s.rollupTiers[i].Table)
+		}
+	}
+
+	var segments []statsSegment
+	lower := ""
+	for _, table := range tables {
+		watermark := watermarks[table]
+		if watermark == "" || watermark <= lower {
+			// Nothing rolled up (beyond the coarser tier) yet
+			continue
+		}
+		segments = append(segments, statsSegment{table: table, from: lower, before: watermark})
+		lower = watermark
+	}
+
+	source.from = lower
+	return append(segments, source)
 }
 
 // AggregatedStat represents aggregated statistics across multiple loggers
@@ -83,30 +179,55 @@ func (s *LogStatStore) QueryLogStats(filter QueryFilter) ([]*LogStat, error) {
 	if filter.LoggerRegex != "" {
 		loggerRegex, err = regexp.Compile(filter.LoggerRegex)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: logger_regex: %v", errInvalidQuery, err)
 		}
 	}
+	dimensions, err := filter.Dimensions.compile()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidQuery, err)
+	}
 
-	// Get in-memory entries
+	// Pick resolution, the start is aligned to its buckets
+	res, err := s.pickResolution(filter)
+	if err != nil {
+		return nil, err
+	}
+	if res.tier != nil && !filter.StartTime.IsZero() {
+		filter.StartTime = getBucketTime(filter.StartTime.Local(), res.tier.BucketSize)
+	}
+
+	// Get in-memory entries of the source bucket size (including a batch being flushed)
 	if filter.IncludeMemory {
 		s.mu.RLock()
-		for _, stat := range s.entries {
-			statCopy := *stat
-			allStats = append(allStats, &statCopy)
+		for _, entries := range s.pendingEntries() {
+			for _, stat := range entries {
+				if stat.BucketSize_S != res.sourceSize {
+					continue
+				}
+				statCopy := *stat
+				allStats = append(allStats, &statCopy)
+			}
 		}
 		s.mu.RUnlock()
 	}
 
 	// Get database entries
 	if filter.IncludeDB {
-		dbStats, err := s.queryDatabaseWithFilter(filter)
-		if err != nil {
-			log.Printf("Error querying database: %v\n", err)
-		} else {
-			allStats = append(allStats, dbStats...)
+		for _, segment := range s.querySegments(res) {
+			dbStats, err := s.queryDatabaseWithFilter(segment, filter)
+			if err != nil {
+				log.Printf("Error querying database: %v\n", err)
+			} else {
+				allStats = append(allStats, dbStats...)
+			}
 		}
 	}
 
+	// Bring finer data to the resolution of the rollup tier
+	if res.tier != nil {
+		allStats = rebucketStats(allStats, res.tier.BucketSize)
+	}
+
 	// Apply filters
 	var filtered []*LogStat
 	for _, stat := range allStats {
@@ -120,6 +241,11 @@ func (s *LogStatStore) QueryLogStats(filter QueryFilter) ([]*LogStat, error) {
 			continue
 		}
 
+		// Filter by level, host and logger lists
+		if !dimensions.matches(stat.HostName, stat.Level, stat.Logger) {
+			continue
+		}
+
 		// Filter by time range
 		if !filter.StartTime.IsZero() || !filter.EndTime.IsZero() {
 			bucketTime, err := time.Parse(time.RFC3339, stat.BucketTS)
@@ -147,66 +273,13 @@ func (s *LogStatStore) QueryLogStats(filter QueryFilter) ([]*LogStat, error) {
 	return filtered, nil
 }
 
-// queryDatabaseWithFilter queries the database with SQL-level filtering for efficiency
-func (s *LogStatStore) queryDatabaseWithFilter(filter QueryFilter) ([]*LogStat, error) {
-	db, err := sql.Open("sqlite", s.dbPath)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	// Build query with filters
-	query := "SELECT id, hostname, bucket_ts, bucket_duration_s, level, logger, n, first_seen_ts FROM log_stats WHERE 1=1"
-	var args []interface{}
-
-	if filter.Level != "" {
-		query += " AND level = ?"
-		args = append(args, filter.Level)
-	}
-
-	// Convert pattern to SQL LIKE
-	if filter.LoggerRegex != "" {
-		likePattern := regexToLike(filter.LoggerRegex)
-		query += " AND logger LIKE ?"
-		args = append(args, likePattern)
+// queryDatabaseWithFilter queries a segment with filtering in the stats backend (log_stats) or in SQL (rollup tables)
+func (s *LogStatStore) queryDatabaseWithFilter(segment statsSegment, filter QueryFilter) ([]*LogStat, error) {
+	q := newStatsQuery(segment, filter)
+	if segment.table == "log_stats" {
+		return s.backend.QueryStats(q)
 	}
-
-	if !filter.StartTime.IsZero() {
-		query += " AND bucket_ts >= ?"
-		args = append(args, filter.StartTime.Format(time.RFC3339))
-	}
-
-	if !filter.EndTime.IsZero() {
-		query += " AND bucket_ts <= ?"
-		args = append(args, filter.EndTime.Format(time.RFC3339))
-	}
-
-	query += " ORDER BY bucket_ts DESC"
-
-	// Apply LIMIT
-	if filter.MaxResults > 0 {
-		query += " LIMIT ?"
-		args = append(args, filter.MaxResults)
-	}
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var stats []*LogStat
-	for rows.Next() {
-		stat := &LogStat{}
-		if err := rows.Scan(&stat.ID, &stat.HostName, &stat.BucketTS, &stat.BucketDuration_S, &stat.Level, &stat.Logger, &stat.N, &stat.FirstSeenTS); err != nil {
-			log.Printf("Error scanning row: %v\n", err)
-			continue
-		}
-
-		stats = append(stats, stat)
-	}
-
-	return stats, rows.Err()
+	return queryStatsTable(s.db, segment.table, q)
 }
 
 // QueryAggregatedStats queries and aggregates statistics across loggers
@@ -259,6 +332,30 @@ func (s *LogStatStore) QueryAggregatedStats(filter QueryFilter) ([]*AggregatedSt
 func (s *LogStatStore) QueryAggregatedStatsOptimized(filter QueryFilter) ([]*AggregatedStat, error) {
 	var allAggregates []*AggregatedStat
 
+	// The database matches the logger regex with the REGEXP function, report syntax errors up front
+	if _, err := compileLoggerRegex(filter.LoggerRegex); err != nil {
+		return nil, fmt.Errorf("%w: logger_regex: %v", errInvalidQuery, err)
+	}
+	if _, err := filter.Dimensions.compile(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidQuery, err)
+	}
+
+	// Pick resolution once so memory and database parts match
+	res, err := s.pickResolution(filter)
+	if err != nil {
+		return nil, err
+	}
+	tier := res.tier
+	filter.Resolution = res.name()
+	if tier != nil {
+		if !filter.StartTime.IsZero() {
+			filter.StartTime = getBucketTime(filter.StartTime.Local(), tier.BucketSize)
+		}
+	}
+
+	// Stats finer than the tier resolution are rebucketed before aggregation
+	var fineStats []*LogStat
+
 	// Aggregate in-memory data
 	if filter.IncludeMemory {
 		memoryStats, err := s.QueryLogStats(QueryFilter{
@@ -268,26 +365,48 @@ func (s *LogStatStore) QueryAggregatedStatsOptimized(filter QueryFilter) ([]*Agg
 			EndTime:       filter.EndTime,
 			IncludeMemory: true,
 			IncludeDB:     false,
+			Resolution:    filter.Resolution,
+			Dimensions:    filter.Dimensions,
 		})
 		if err != nil {
 			return nil, err
 		}
-
-		// Aggregate memory stats
-		memoryAgg := aggregateStats(memoryStats)
-		allAggregates = append(allAggregates, memoryAgg...)
+		fineStats = append(fineStats, memoryStats...)
 	}
 
 	// Aggregate database data using SQL
 	if filter.IncludeDB {
-		dbAgg, err := s.queryAggregatedFromDB(filter)
-		if err != nil {
-			log.Printf("Error querying aggregated database: %v\n", err)
-		} else {
-			allAggregates = append(allAggregates, dbAgg...)
+		for _, segment := range s.querySegments(res) {
+			if tier != nil && segment.table != tier.Table {
+				dbStats, err := s.queryDatabaseWithFilter(segment, QueryFilter{
+					Level:       filter.Level,
+					LoggerRegex: filter.LoggerRegex,
+					StartTime:   filter.StartTime,
+					EndTime:     filter.EndTime,
+					Dimensions:  filter.Dimensions,
+				})
+				if err != nil {
+					log.Printf("Error querying database: %v\n", err)
+				} else {
+					fineStats = append(fineStats, dbStats...)
+				}
+				continue
+			}
+
+			dbAgg, err := s.queryAggregatedFromDB(segment, filter)
+			if err != nil {
+				log.Printf("Error querying aggregated database: %v\n", err)
+			} else {
+				allAggregates = append(allAggregates, dbAgg...)
+			}
 		}
 	}
 
+	if tier != nil {
+		fineStats = rebucketStats(fineStats, tier.BucketSize)
+	}
+	allAggregates = append(allAggregates, aggregateStats(fineStats)...)
+
 	// Merge aggregates with same key
 	return mergeAggregates(allAggregates), nil
 }
@@ -313,188 +432,106 @@ func dbQueryInt64(db *sql.DB, query string, args ...interface{}) int64 {
 }
 
 // dbStats, returns map[string]interface{} with comprehensive database statistics
-func (s LogStatStore) dbStats(retentionDays int) (map[string]interface{}, error) {
+func (s *LogStatStore) dbStats(retentionDays int) (map[string]interface{}, error) {
 
-	// db connection
-	db, err := sql.Open("sqlite", s.dbPath)
+	// Counts refer to the primary bucket size, other resolutions are listed separately
+	primarySize := int(s.bucketSize.Seconds())
+	primary, err := s.backend.Stats(primarySize)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	// Basic counts using helper functions
-	var oldestBucket, newestBucket string
-
-	uniqueBuckets := dbQueryInt(db, "SELECT count(distinct bucket_ts) FROM log_stats")
-	totalEntries := dbQueryInt(db, "SELECT count(*) FROM log_stats")
-	uniqueLevels := dbQueryInt(db, "SELECT count(distinct level) FROM log_stats")
-	uniqueLoggers := dbQueryInt(db, "SELECT count(distinct logger) FROM log_stats")
-	uniqueHosts := dbQueryInt(db, "SELECT count(distinct hostname) FROM log_stats")
-	totalMessages := dbQueryInt64(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats")
-
-	// Get date range
-	query_date_range := "SELECT MIN(bucket_ts), MAX(bucket_ts) FROM log_stats"
-	if err := db.QueryRow(query_date_range).Scan(&oldestBucket, &newestBucket); err != nil {
-		// If no data, set to empty strings
-		oldestBucket = ""
-		newestBucket = ""
-	}
 
 	// Get database file size
-	pageCount := dbQueryInt(db, "PRAGMA page_count")
-	pageSize := dbQueryInt(db, "PRAGMA page_size")
+	pageCount := dbQueryInt(s.db, "PRAGMA page_count")
+	pageSize := dbQueryInt(s.db, "PRAGMA page_size")
 	dbSizeMB := float64(pageCount*pageSize) / (1024 * 1024)
 
 	// Collect results
 	res := map[string]interface{}{}
-	res["unique_loggers"] = uniqueLoggers
-	res["unique_levels"] = uniqueLevels
-	res["unique_hosts"] = uniqueHosts
-	res["total_entries"] = totalEntries
-	res["unique_buckets"] = uniqueBuckets
-	res["total_messages"] = totalMessages
-	res["oldest_bucket"] = oldestBucket
-	res["newest_bucket"] = newestBucket
+	res["backend"] = s.backend.Name()
+	res["unique_loggers"] = primary.UniqueLoggers
+	res["unique_levels"] = primary.UniqueLevels
+	res["unique_hosts"] = primary.UniqueHosts
+	res["total_entries"] = primary.Rows
+	res["unique_buckets"] = primary.UniqueBuckets
+	res["total_messages"] = primary.TotalMessages
+	res["oldest_bucket"] = primary.OldestBucket
+	res["newest_bucket"] = primary.NewestBucket
 	res["db_size_mb"] = dbSizeMB
 	res["retention_days"] = retentionDays
+	if version, err := getSchemaVersion(s.db); err == nil {
+		res["schema_version"] = version
+	}
+
+	// Rollup tiers
+	rollups := make([]map[string]interface{}, 0, len(s.rollupTiers))
+	for _, tier := range s.rollupTiers {
+		var oldest, newest sql.NullString
+		s.db.QueryRow("SELECT MIN(bucket_ts), MAX(bucket_ts) FROM "+tier.Table).Scan(&oldest, &newest)
+		rollups = append(rollups, map[string]interface{}{
+			"name":           tier.Name,
+			"rows":           dbQueryInt(s.db, "SELECT count(*) FROM "+tier.Table),
+			"oldest_bucket":  oldest.String,
+			"newest_bucket":  newest.String,
+			"retention_days": tier.RetentionDays,
+		})
+	}
+	res["rollups"] = rollups
+
+	// Bucket resolutions maintained from the ingest stream
+	resolutions := make([]map[string]interface{}, 0, len(s.resolutions))
+	for _, resolution := range s.resolutions {
+		stats := primary
+		if sizeS := int(resolution.Size.Seconds()); sizeS != primarySize {
+			if stats, err = s.backend.Stats(sizeS); err != nil {
+				log.Printf("Error reading stats of bucket size %v: %v\n", resolution.Size, err)
+				continue
+			}
+		}
+		resolutions = append(resolutions, map[string]interface{}{
+			"bucket_size":    resolution.Size.String(),
+			"rows":           stats.Rows,
+			"oldest_bucket":  stats.OldestBucket,
+			"newest_bucket":  stats.NewestBucket,
+			"retention_days": resolution.RetentionDays,
+		})
+	}
+	res["resolutions"] = resolutions
 
 	// Message counts by level (sum of n, not count of rows)
-	res["n_debug"] = dbQueryInt(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats WHERE level='DEBUG'")
-	res["n_trace"] = dbQueryInt(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats WHERE level='TRACE'")
-	res["n_info"] = dbQueryInt(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats WHERE level='INFO'")
-	res["n_warn"] = dbQueryInt(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats WHERE level='WARN' OR level='WARNING'")
-	res["n_error"] = dbQueryInt(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats WHERE level='ERROR'")
-	res["n_fatal"] = dbQueryInt(db, "SELECT COALESCE(SUM(n), 0) FROM log_stats WHERE level='FATAL'")
+	res["n_debug"] = primary.MessagesByLevel["DEBUG"]
+	res["n_trace"] = primary.MessagesByLevel["TRACE"]
+	res["n_info"] = primary.MessagesByLevel["INFO"]
+	res["n_warn"] = primary.MessagesByLevel["WARN"] + primary.MessagesByLevel["WARNING"]
+	res["n_error"] = primary.MessagesByLevel["ERROR"]
+	res["n_fatal"] = primary.MessagesByLevel["FATAL"]
 
 	// Recent activity by level for multiple time windows (24h, 8h, 1h)
-	recentActivityQuery := `
-		SELECT level, COALESCE(SUM(n), 0) as message_count 
-		FROM log_stats 
-		WHERE bucket_ts >= ? 
-		GROUP BY level 
-		ORDER BY message_count DESC
-	`
-
-	// 24-hour window
-	cutoffTime24h := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
-	rows24h, err := db.Query(recentActivityQuery, cutoffTime24h)
-	if err == nil {
-		defer rows24h.Close()
-		recentActivity24h := make(map[string]int64)
-		for rows24h.Next() {
-			var level string
-			var count int64
-			if err := rows24h.Scan(&level, &count); err == nil {
-				recentActivity24h[level] = count
-			}
-		}
-		res["recent_activity_24h"] = recentActivity24h
-	}
-
-	// 8-hour window
-	cutoffTime8h := time.Now().Add(-8 * time.Hour).Format(time.RFC3339)
-	rows8h, err := db.Query(recentActivityQuery, cutoffTime8h)
-	if err == nil {
-		defer rows8h.Close()
-		recentActivity8h := make(map[string]int64)
-		for rows8h.Next() {
-			var level string
-			var count int64
-			if err := rows8h.Scan(&level, &count); err == nil {
-				recentActivity8h[level] = count
-			}
-		}
-		res["recent_activity_8h"] = recentActivity8h
-	}
-
-	// 1-hour window
-	cutoffTime1h := time.Now().Add(-1 * time.Hour).Format(time.RFC3339)
-	rows1h, err := db.Query(recentActivityQuery, cutoffTime1h)
-	if err == nil {
-		defer rows1h.Close()
-		recentActivity1h := make(map[string]int64)
-		for rows1h.Next() {
-			var level string
-			var count int64
-			if err := rows1h.Scan(&level, &count); err == nil {
-				recentActivity1h[level] = count
-			}
+	windows := []struct {
+		key    string
+		period time.Duration
+	}{
+		{"recent_activity_24h", 24 * time.Hour},
+		{"recent_activity_8h", 8 * time.Hour},
+		{"recent_activity_1h", 1 * time.Hour},
+	}
+	for _, window := range windows {
+		cutoffTime := time.Now().Add(-window.period).Format(time.RFC3339)
+		if counts, err := s.backend.LevelCounts(primarySize, cutoffTime); err == nil {
+			res[window.key] = counts
 		}
-		res["recent_activity_1h"] = recentActivity1h
 	}
 
 	return res, nil
 }
 
-// queryAggregatedFromDB performs aggregation using SQL GROUP BY
-func (s *LogStatStore) queryAggregatedFromDB(filter QueryFilter) ([]*AggregatedStat, error) {
-	db, err := sql.Open("sqlite", s.dbPath)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	query := `
-		SELECT 
-			hostname,
-			bucket_ts,
-			level,
-			SUM(n) as total_count,
-			COUNT(DISTINCT logger) as logger_count,
-			MIN(first_seen_ts) as first_seen_ts
-		FROM log_stats
-		WHERE 1=1
-	`
-	var args []interface{}
-
-	if filter.Level != "" {
-		query += " AND level = ?"
-		args = append(args, filter.Level)
+// queryAggregatedFromDB performs aggregation in the stats backend (log_stats) or using SQL GROUP BY (rollup tables)
+func (s *LogStatStore) queryAggregatedFromDB(segment statsSegment, filter QueryFilter) ([]*AggregatedStat, error) {
+	q := newStatsQuery(segment, filter)
+	if segment.table == "log_stats" {
+		return s.backend.AggregateStats(q)
 	}
-
-	// Convert pattern to SQL LIKE
-	if filter.LoggerRegex != "" {
-		likePattern := regexToLike(filter.LoggerRegex)
-		query += " AND logger LIKE ?"
-		args = append(args, likePattern)
-	}
-
-	if !filter.StartTime.IsZero() {
-		query += " AND bucket_ts >= ?"
-		args = append(args, filter.StartTime.Format(time.RFC3339))
-	}
-
-	if !filter.EndTime.IsZero() {
-		query += " AND bucket_ts <= ?"
-		args = append(args, filter.EndTime.Format(time.RFC3339))
-	}
-
-	query += " GROUP BY hostname, bucket_ts, level"
-	query += " ORDER BY bucket_ts DESC"
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// Read aggregated rows directly
-	var aggregated []*AggregatedStat
-	for rows.Next() {
-		agg := &AggregatedStat{}
-		if err := rows.Scan(&agg.HostName, &agg.BucketTS, &agg.Level, &agg.TotalCount, &agg.LoggerCount, &agg.FirstSeenTS); err != nil {
-			log.Printf("Error scanning aggregated row: %v\n", err)
-			continue
-		}
-		aggregated = append(aggregated, agg)
-	}
-
-	// Apply max results filter if specified
-	if filter.MaxResults > 0 && len(aggregated) > filter.MaxResults {
-		aggregated = aggregated[:filter.MaxResults]
-	}
-
-	return aggregated, rows.Err()
+	return aggregateStatsTable(s.db, segment.table, q)
 }
 
 // aggregateStats aggregates a slice of LogStats
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
-	"regexp"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -14,66 +15,202 @@ import (
 
 // LogStatStore manages in-memory storage of LogStat entries organized by time buckets
 type LogStatStore struct {
-	entries      map[string]*LogStat // key: "host:level:logger:bucketTS"
+	entries      map[string]*LogStat // key: "bucketSize:host:logger:level:bucketTS"
 	nextID       int
-	bucketSize   time.Duration
+	bucketSize   time.Duration      // primary bucket size
+	resolutions  []BucketResolution // all bucket sizes maintained from the ingest stream, primary first
 	appStartTime time.Time
 	mu           sync.RWMutex
-	dbPath       string // path to SQLite database file
-	verbose      bool   // enable verbose output
-	hub          *Hub   // WebSocket hub for broadcasting
+	dbPath       string         // path to SQLite database file
+	db           *sql.DB        // long-lived connection pool, opened by InitDB
+	backend      StatsBackend   // storage of the flushed buckets, opened by InitDB
+	backendName  string         // "sqlite" or "columnar"
+	columnarDir  string         // directory of the columnar backend
+	rollupTiers  []RollupTier   // downsampled tiers with longer retention
+	verbose      bool           // enable verbose output
+	hub          *Hub           // WebSocket hub for broadcasting
+	rejected     *RejectedStore // dead-letter store for lines that failed to parse
+	journal      *StatJournal   // append-only journal of in-memory deltas (nil = disabled)
+	archive      *RawArchive    // compressed archive of raw messages (nil = disabled)
+
+	// Full-text message search (nil = disabled)
+	search     *MessageSearch
+	searchDocs []*searchDoc // selected messages not yet indexed
+
+	// Flushing
+	flushMu         sync.Mutex // serializes flushes, s.mu is only held to detach and merge back
+	flushStats      FlushStats
+	flushInFlight   *flushBatch         // batch currently written, its data still counts as in-memory (nil = none)
+	journalSegments []string            // sealed journal segments not yet flushed
+	catalogEntries  map[string]*LogStat // buckets in the stats backend whose catalog totals are not yet written
+
+	hostIdentityMode string        // handling of client certificate identities ("override" or "validate")
+	fieldMapping     *FieldMapping // JSON field mapping for incoming entries
+	promotedFields   []string      // context fields appended to the logger name of the log stats
+	rules            *RuleEngine   // ingest rules applied to every entry
+
+	// Message pattern mining (nil = disabled)
+	patterns       *PatternMiner
+	patternEntries map[string]*PatternStat // key: "host:logger:level:pattern:bucketTS"
+
+	// Stack trace fingerprints
+	fingerprinter    *StackFingerprinter
+	stackTraces      map[string]*StackTraceInfo // fingerprints seen since last flush
+	exceptionEntries map[string]*ExceptionStat  // key: "fingerprint:host:logger:level:bucketTS"
+
+	// Late arrival handling
+	lateWindow  time.Duration // entries older than this (relative to arrival) are considered late
+	latePolicy  string        // "upsert", "arrival" or "drop"
+	lateCount   int64         // number of late entries seen
+	lateDropped int64         // number of late entries dropped
 }
 
+// BucketResolution is a bucket size maintained from the ingest stream with its database retention
+type BucketResolution struct {
+	Size          time.Duration `json:"size"`
+	RetentionDays int           `json:"retention_days"`
+}
+
+// Late arrival policies
+const (
+	LatePolicyUpsert  = "upsert"  // bucket by event time, flush adds to already persisted rows
+	LatePolicyArrival = "arrival" // bucket by arrival time (previous behaviour)
+	LatePolicyDrop    = "drop"    // discard late entries, only count them
+)
+
 // NewLogStatStore creates a new store instance with the specified bucket size
 func NewLogStatStore(bucketSize time.Duration, dbPath string, verbose bool) *LogStatStore {
 	return &LogStatStore{
-		entries:      make(map[string]*LogStat),
-		nextID:       1,
-		bucketSize:   bucketSize,
-		appStartTime: time.Now(),
-		dbPath:       dbPath,
-		verbose:      verbose,
+		entries:          make(map[string]*LogStat),
+		catalogEntries:   make(map[string]*LogStat),
+		nextID:           1,
+		bucketSize:       bucketSize,
+		appStartTime:     time.Now(),
+		dbPath:           dbPath,
+		backendName:      "sqlite",
+		resolutions:      []BucketResolution{{Size: bucketSize, RetentionDays: 7}},
+		rollupTiers:      DefaultRollupTiers(90, 730),
+		verbose:          verbose,
+		rejected:         NewRejectedStore(1000),
+		hostIdentityMode: HostIdentityOverride,
+		fieldMapping:     DefaultFieldMapping(),
+		patternEntries:   make(map[string]*PatternStat),
+		fingerprinter:    NewStackFingerprinter(nil, 5),
+		stackTraces:      make(map[string]*StackTraceInfo),
+		exceptionEntries: make(map[string]*ExceptionStat),
+		lateWindow:       15 * time.Minute,
+		latePolicy:       LatePolicyUpsert,
+	}
+}
+
+// SetLateArrivalPolicy configures how entries with event timestamps older than the window are handled
+func (s *LogStatStore) SetLateArrivalPolicy(window time.Duration, policy string) error {
+	switch policy {
+	case LatePolicyUpsert, LatePolicyArrival, LatePolicyDrop:
+	default:
+		return fmt.Errorf("invalid late policy %q (allowed: %s, %s, %s)", policy, LatePolicyUpsert, LatePolicyArrival, LatePolicyDrop)
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lateWindow = window
+	s.latePolicy = policy
+	return nil
 }
 
-// AddOrUpdate adds a log entry to the appropriate time bucket or updates an existing bucket entry
-func (s *LogStatStore) AddOrUpdate(hostName, level string, logger string) *LogStat {
+// AddOrUpdate adds a log entry to the time bucket of its event timestamp or updates an existing bucket entry.
+// A zero or future event time falls back to the arrival time. Returns nil if the entry was dropped as late.
+func (s *LogStatStore) AddOrUpdate(hostName, level string, logger string, eventTime time.Time) *LogStat {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	currentTime := time.Now()
-	bucketStartTime := getBucketTime(currentTime, s.bucketSize)
+
+	// Normalize to local time so bucket timestamps are formatted consistently
+	if eventTime.IsZero() || eventTime.After(currentTime) {
+		eventTime = currentTime
+	} else {
+		eventTime = eventTime.Local()
+	}
+
+	// Handle late arrivals
+	if s.lateWindow > 0 && currentTime.Sub(eventTime) > s.lateWindow {
+		s.lateCount++
+		switch s.latePolicy {
+		case LatePolicyDrop:
+			s.lateDropped++
+			return nil
+		case LatePolicyArrival:
+			eventTime = currentTime
+		}
+	}
+
+	// Journal the delta before counting so it can be replayed after a crash
+	if s.journal != nil {
+		s.journal.Append(JournalRecord{
+			EventTS: eventTime.Format(time.RFC3339Nano),
+			Host:    hostName,
+			Level:   level,
+			Logger:  logger,
+		})
+	}
+
+	// Update the bucket of every resolution, the primary one is returned
+	var primary *LogStat
+	for _, res := range s.resolutions {
+		stat := s.addToBucket(hostName, level, logger, eventTime, currentTime, res.Size)
+		if primary == nil {
+			primary = stat
+		}
+	}
+	return primary
+}
+
+// addToBucket counts an entry in its bucket of the given size. Must be called with s.mu held.
+func (s *LogStatStore) addToBucket(hostName, level, logger string, eventTime, currentTime time.Time, bucketSize time.Duration) *LogStat {
+	bucketStartTime := getBucketTime(eventTime, bucketSize)
 	bucketTS := bucketStartTime.Format(time.RFC3339)
 
-	// Create key including bucket timestamp
-	key := hostName + ":" + logger + ":" + level + ":" + bucketTS
+	// Create key including bucket size and timestamp
+	key := bucketSize.String() + ":" + hostName + ":" + logger + ":" + level + ":" + bucketTS
 
 	if stat, exists := s.entries[key]; exists {
 
 		// Update existing entry
 		stat.N++
+		if eventTime.Format(time.RFC3339) < stat.FirstSeenTS {
+			stat.FirstSeenTS = eventTime.Format(time.RFC3339)
+		}
 		return stat
 
 	} else {
 
 		// Create new entry
 		var duration int
-		if s.appStartTime.After(bucketStartTime) {
-			// First bucket may be partial (from app start to now)
-			duration = int(currentTime.Sub(s.appStartTime).Seconds())
+		bucketEndTime := bucketStartTime.Add(bucketSize)
+		if s.appStartTime.After(bucketStartTime) && s.appStartTime.Before(bucketEndTime) {
+			// Bucket containing app start may be partial (from app start to now, at most to its end:
+			// late entries and journal replays create it after it ended)
+			end := currentTime
+			if end.After(bucketEndTime) {
+				end = bucketEndTime
+			}
+			duration = int(end.Sub(s.appStartTime).Seconds())
 		} else {
 			// Other buckets have full size
-			duration = int(s.bucketSize.Seconds())
+			duration = int(bucketSize.Seconds())
 		}
 
 		stat := &LogStat{
 			HostName:         hostName,
 			BucketTS:         bucketTS,
 			BucketDuration_S: duration,
+			BucketSize_S:     int(bucketSize.Seconds()),
 			Level:            level,
 			Logger:           logger,
 			N:                1,
-			FirstSeenTS:      currentTime.Format(time.RFC3339),
+			FirstSeenTS:      eventTime.Format(time.RFC3339),
 		}
 
 		s.entries[key] = stat
@@ -82,16 +219,35 @@ func (s *LogStatStore) AddOrUpdate(hostName, level string, logger string) *LogSt
 	}
 }
 
-// GetAll returns all log stat entries
+// GetLateStats returns counters for late arriving entries
+func (s *LogStatStore) GetLateStats() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return map[string]interface{}{
+		"late_window":  s.lateWindow.String(),
+		"late_policy":  s.latePolicy,
+		"late_total":   s.lateCount,
+		"late_dropped": s.lateDropped,
+	}
+}
+
+// GetAll returns all log stat entries of the primary bucket size
 func (s *LogStatStore) GetAll() []*LogStat {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	primarySize := int(s.bucketSize.Seconds())
 	stats := make([]*LogStat, 0, len(s.entries))
-	for _, stat := range s.entries {
-		// Make a copy to avoid race conditions
-		statCopy := *stat
-		stats = append(stats, &statCopy)
+	for _, entries := range s.pendingEntries() {
+		for _, stat := range entries {
+			if stat.BucketSize_S != primarySize {
+				continue
+			}
+			// Make a copy to avoid race conditions
+			statCopy := *stat
+			stats = append(stats, &statCopy)
+		}
 	}
 
 	return stats
@@ -105,77 +261,144 @@ func (s *LogStatStore) GetCount() int {
 	return len(s.entries)
 }
 
-func (s *LogStatStore) handleJsonLogEntry(line string) {
+// handleJsonLogEntry parses a JSON log line and adds it to the store.
+// Lines that fail to parse are recorded in the dead-letter store.
+// trustedHost is the host identity from a verified client certificate ("" if none).
+func (s *LogStatStore) handleJsonLogEntry(line string, remoteAddr string, trustedHost string) error {
 	// Try to parse as JSON
 	var logEntry map[string]interface{}
 	err := json.Unmarshal([]byte(line), &logEntry)
+	if err == nil && logEntry == nil {
+		err = errNotJSONObject
+	}
 
 	if err == nil {
-		// Extract fields
-		level := ""
-		loggerName := ""
-		hostName := ""
-		message := ""
-		stackTrace := ""
-		timestamp := time.Now()
-
-		if lvl, ok := logEntry["level"]; ok {
-			level = fmt.Sprintf("%v", lvl)
-		}
-		if log, ok := logEntry["loggerName"]; ok {
-			loggerName = fmt.Sprintf("%v", log)
-		}
-		if h, ok := logEntry["hostName"]; ok {
-			hostName = fmt.Sprintf("%v", h)
+		entry := s.extractJsonLogEntry(logEntry)
+		if err = s.applyHostIdentity(entry, trustedHost); err == nil {
+			s.ingestEntry(entry)
 		}
-		if msg, ok := logEntry["message"].(string); ok {
-			message = msg
-		}
-		if st, ok := logEntry["stackTrace"].(string); ok {
-			stackTrace = st
-		}
-		if ts, ok := logEntry["timestamp"].(string); ok {
-			// Try to parse timestamp
-			if parsedTS, err := time.Parse(time.RFC3339, ts); err == nil {
-				timestamp = parsedTS
-			}
+	}
+
+	if err != nil {
+		// Parse error, quarantine the line and keep going
+		s.rejected.Add(remoteAddr, line, err)
+		if s.verbose {
+			log.Printf("Rejected line from %s: %v\n", remoteAddr, err)
 		}
+	}
+
+	return err
+}
+
+// extractJsonLogEntry extracts the log entry fields from a parsed JSON object using the field mapping
+func (s *LogStatStore) extractJsonLogEntry(logEntry map[string]interface{}) *RawLogEntry {
+	return s.fieldMapping.Extract(logEntry)
+}
 
-		// handle timer loggers
-		if !strings.Contains(strings.ToLower(loggerName), "peter") && strings.Contains(strings.ToLower(loggerName), "timer") {
-			// extract timer id from message field, pattern = "timedObjectId=restjms19.restjms19.SchedMe"
-			timerID := "Unknown"
-			// Use regex to extract timedObjectId value
-			timer_regex := regexp.MustCompile(`timedObjectId=([^\s\)]+)`)
-			matches := timer_regex.FindStringSubmatch(message)
-			if len(matches) > 1 {
-				timerID = matches[1]
+// ingestEntry adds a parsed log entry to the store and broadcasts it to WebSocket clients.
+// This is the common path for all ingest listeners (JSON/TCP, syslog, ...).
+func (s *LogStatStore) ingestEntry(entry *RawLogEntry) {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	// Apply ingest rules (rewrite, label or drop)
+	if s.rules != nil {
+		if result := s.rules.Apply(entry); result.Dropped {
+			if s.verbose {
+				log.Printf("[host: %s,  loggerName: %s, level:%s] = dropped by rule %s\n", entry.Host, entry.Logger, entry.Level, result.Matched[len(result.Matched)-1])
 			}
-			loggerName = loggerName + ":" + timerID
+			return
 		}
+	}
 
-		// Add or update in store
-		stat := s.AddOrUpdate(hostName, level, loggerName)
-
-		// Broadcast to WebSocket clients
-		if s.hub != nil {
-			rawEntry := &RawLogEntry{
-				Timestamp:  timestamp,
-				Host:       hostName,
-				Logger:     loggerName,
-				Level:      level,
-				Message:    message,
-				StackTrace: stackTrace,
-			}
-			s.hub.BroadcastLog(rawEntry)
+	// Add or update in store, counted per promoted field value
+	stat := s.AddOrUpdate(entry.Host, entry.Level, s.promotedLogger(entry), entry.Timestamp)
+
+	// Assign the message to its pattern and count it in the same bucket
+	if stat != nil && s.patterns != nil {
+		entry.PatternID = s.patterns.Match(entry.Logger, entry.Message, entry.Timestamp)
+		s.addPatternStat(entry, stat.BucketTS)
+	}
+
+	// Fingerprint stack traces for exception statistics
+	if stat != nil && entry.StackTrace != "" {
+		s.recordException(entry, stat.BucketTS)
+	}
+
+	// Keep the raw message of counted entries
+	if stat != nil && s.archive != nil {
+		s.archive.Append(entry)
+	}
+
+	// Queue selected messages for the full-text index
+	if stat != nil && s.search != nil {
+		s.addSearchDoc(entry)
+	}
+
+	// Broadcast to WebSocket clients
+	if s.hub != nil {
+		s.hub.BroadcastLog(entry)
+	}
+
+	// Simple output
+	if s.verbose {
+		if stat == nil {
+			log.Printf("[host: %s,  loggerName: %s, level:%s] = dropped (late, timestamp %s)\n", entry.Host, entry.Logger, entry.Level, entry.Timestamp.Format(time.RFC3339))
+		} else {
+			log.Printf("[host: %s,  loggerName: %s, level:%s] = Count: %d\n", entry.Host, entry.Logger, entry.Level, stat.N)
 		}
+	}
+}
 
-		// Simple output
-		if s.verbose {
-			log.Printf("[host: %s,  loggerName: %s, level:%s] = Count: %d\n", hostName, loggerName, level, stat.N)
+// hostFromRemoteAddr returns the host part of a "host:port" address, used when a message carries no hostname
+func hostFromRemoteAddr(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// promotedLogger returns the logger name the log stats of an entry are counted under: the logger with
+// the promoted context fields appended, e.g. "org.example.Service:tenant=acme". Only the log stats (and
+// the logger catalog) use it; patterns, exceptions, the archive, the search index and the live stream
+// keep the logger of the entry.
+func (s *LogStatStore) promotedLogger(entry *RawLogEntry) string {
+	logger := entry.Logger
+	for _, field := range s.promotedFields {
+		if value, ok := entry.DimensionValue(field); ok {
+			name := strings.TrimPrefix(strings.TrimPrefix(field, "mdc."), "label.")
+			logger += ":" + name + "=" + value
 		}
-	} else {
-		// Parse error, just print the line
-		log.Fatalf("[%s]", line)
 	}
+	return logger
+}
+
+// TestRules shows what a sample JSON log line becomes after field mapping, ingest rules
+// and field promotion, without adding it to the store
+func (s *LogStatStore) TestRules(line string) (map[string]interface{}, error) {
+	var logEntry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &logEntry); err != nil {
+		return nil, err
+	}
+
+	entry := s.extractJsonLogEntry(logEntry)
+	input := TransformMessage(entry, nil)
+
+	result := &RuleResult{Matched: []string{}}
+	if s.rules != nil {
+		result = s.rules.Test(entry)
+	}
+	countedLogger := ""
+	if !result.Dropped {
+		countedLogger = s.promotedLogger(entry)
+	}
+
+	return map[string]interface{}{
+		"input":          input,
+		"output":         TransformMessage(entry, nil),
+		"counted_logger": countedLogger,
+		"matched":        result.Matched,
+		"dropped":        result.Dropped,
+	}, nil
 }
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,6 +27,58 @@ func (s *LogStatStore) PrintSummary() {
 	fmt.Println()
 }
 
+// validBucketSizes are the allowed bucket sizes (all divide an hour and a day evenly)
+var validBucketSizes = map[time.Duration]bool{
+	1 * time.Minute:  true,
+	5 * time.Minute:  true,
+	10 * time.Minute: true,
+	15 * time.Minute: true,
+	20 * time.Minute: true,
+	30 * time.Minute: true,
+	60 * time.Minute: true,
+}
+
+// ParseBucketResolutions parses additional bucket resolutions given as
+// comma-separated "size:retentionDays" pairs, e.g. "15m:90,60m:365"
+func ParseBucketResolutions(spec string) ([]BucketResolution, error) {
+	var resolutions []BucketResolution
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		sizeStr, daysStr, found := strings.Cut(part, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid bucket resolution %q (expected size:retentionDays)", part)
+		}
+		size, err := time.ParseDuration(sizeStr)
+		if err != nil || !validBucketSizes[size] {
+			return nil, fmt.Errorf("invalid bucket size %q. Allowed values: 1m, 5m, 10m, 15m, 20m, 30m, 60m", sizeStr)
+		}
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid retention days %q for bucket size %s", daysStr, sizeStr)
+		}
+
+		resolutions = append(resolutions, BucketResolution{Size: size, RetentionDays: days})
+	}
+
+	return resolutions, nil
+}
+
+// finestResolution returns the resolution with the smallest bucket size (rollup source)
+func finestResolution(resolutions []BucketResolution) BucketResolution {
+	finest := resolutions[0]
+	for _, res := range resolutions[1:] {
+		if res.Size < finest.Size {
+			finest = res
+		}
+	}
+	return finest
+}
+
 // getBucketTime returns the start time of the bucket that contains the given timestamp
 // Buckets align to clock boundaries (e.g., for 5m buckets: 00:00, 05:00, 10:00, etc.)
 func getBucketTime(ts time.Time, bucketSize time.Duration) time.Time {
@@ -41,3 +95,22 @@ func getBucketTime(ts time.Time, bucketSize time.Duration) time.Time {
 	bucketStartTime := dayStart.Add(time.Duration(bucketIndex) * bucketSize)
 	return bucketStartTime
 }
+
+// levelSeverities ranks log level names from TRACE (0) to FATAL (5). JUL level names are ranked with
+// their log4j/JBoss equivalents.
+var levelSeverities = map[string]int{
+	"TRACE": 0, "FINEST": 0, "FINER": 0,
+	"DEBUG": 1, "FINE": 1, "CONFIG": 1,
+	"INFO": 2,
+	"WARN": 3, "WARNING": 3,
+	"ERROR": 4, "SEVERE": 4,
+	"FATAL": 5, "CRITICAL": 5,
+}
+
+// levelSeverity returns the rank of a log level name (case-insensitive), -1 for unknown levels
+func levelSeverity(level string) int {
+	if severity, known := levelSeverities[strings.ToUpper(level)]; known {
+		return severity
+	}
+	return -1
+}
@@ -2,187 +2,183 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-// InitDB ensures the database table exists
-func (s *LogStatStore) InitDB() error {
-	db, err := sql.Open("sqlite", s.dbPath)
+// OpenDatabase opens the long-lived connection pool of the database. The pragmas are applied
+// to every connection of the pool.
+func OpenDatabase(dbPath string) (*sql.DB, error) {
+	dsn := dbPath +
+		"?_pragma=journal_mode(WAL)" + // Write-Ahead Logging for better concurrency
+		"&_pragma=synchronous(NORMAL)" + // Faster writes with reasonable durability
+		"&_pragma=cache_size(-64000)" + // 64MB cache
+		"&_pragma=temp_store(MEMORY)" + // Use memory for temp tables
+		"&_pragma=busy_timeout(10000)" + // Wait for concurrent writers (flush, maintenance)
+		"&_pragma=foreign_keys(1)" // Enforce the dimension references of log_stats
+
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	db.SetMaxOpenConns(8)
+	db.SetMaxIdleConns(4)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
-	defer db.Close()
-
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS log_stats (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		hostname TEXT NOT NULL,
-		bucket_ts TEXT NOT NULL,
-		bucket_duration_s INTEGER NOT NULL,
-		level TEXT NOT NULL,
-		logger TEXT NOT NULL,
-		n INTEGER NOT NULL,
-		first_seen_ts TEXT NOT NULL DEFAULT '',
-		UNIQUE(hostname, bucket_ts, level, logger)
-	);
-	`
-	_, err = db.Exec(createTableSQL)
+	return db, nil
+}
+
+// InitDB opens the database and migrates it to the current schema version
+func (s *LogStatStore) InitDB() error {
+	db, err := OpenDatabase(s.dbPath)
 	if err != nil {
 		return err
 	}
 
-	// Create index on bucket_ts for faster queries and cleanup operations
-	indexSQL := `CREATE INDEX IF NOT EXISTS idx_bucket_ts ON log_stats(bucket_ts);`
-	_, err = db.Exec(indexSQL)
+	version, err := migrateDB(db, migrationEnv{primaryBucketSizeS: int(s.bucketSize.Seconds())})
 	if err != nil {
+		db.Close()
 		return err
 	}
+	log.Printf("=== Database %s at schema version %d ===\n", s.dbPath, version)
 
-	// Set SQLite performance optimizations
-	pragmas := []string{
-		"PRAGMA journal_mode=WAL",
-		"PRAGMA synchronous=NORMAL",
-		"PRAGMA cache_size=-64000",
-		"PRAGMA temp_store=MEMORY",
-	}
-	for _, pragma := range pragmas {
-		if _, err := db.Exec(pragma); err != nil {
-			log.Printf("Warning: failed to set pragma during init: %v\n", err)
+	// Stats backend, rollups, patterns and exceptions stay in the database
+	var backend StatsBackend
+	switch s.backendName {
+	case "columnar":
+		backend, err = NewColumnarBackend(s.columnarDir)
+		if err != nil {
+			db.Close()
+			return err
 		}
+		log.Printf("=== Stats backend: columnar (%s) ===\n", s.columnarDir)
+	default:
+		backend = NewSQLiteBackend(db)
 	}
 
+	s.db = db
+	s.backend = backend
 	return nil
 }
 
-// FlushToDb writes all LogStat entries to SQLite database and clears the store
+// CloseDB closes the stats backend and the database connection pool
+func (s *LogStatStore) CloseDB() error {
+	if s.backend != nil {
+		s.backend.Close()
+	}
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// FlushToDb writes all LogStat entries to SQLite database. The entries are detached from the store first,
+// so ingestion continues during the transaction. Failed writes are retried with backoff, if all attempts
+// fail the entries are merged back into the store for the next flush.
 func (s *LogStatStore) FlushToDb() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	// One flush at a time (periodic and shutdown flush)
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
 
-	// log time taken for flush
-	defer func(start time.Time) {
-		log.Printf("    "+"FlushToDb took %v", time.Since(start))
-		log.Printf("=== Successfully flushed data to database and cleared store ===\n")
-	}(time.Now())
+	start := time.Now()
+	batch := s.takeFlushBatch()
 
-	log.Printf("=== Flushing %d entries to database: %s ===\n", len(s.entries), s.dbPath)
+	log.Printf("=== Flushing %d entries to database: %s ===\n", len(batch.entries), s.dbPath)
 	log.Print("    " + GetMemoryStatsString())
 
-	// Open or create database
-	db, err := sql.Open("sqlite", s.dbPath)
+	var err error
+	backoff := flushRetryBackoff
+	for attempt := 1; attempt <= flushRetryAttempts; attempt++ {
+		if err = s.writeFlushBatch(batch); err == nil {
+			break
+		}
+		s.recordFlushFailure(err)
+		log.Printf("Error flushing to database (attempt %d/%d): %v\n", attempt, flushRetryAttempts, err)
+		if attempt < flushRetryAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
 	if err != nil {
-		log.Printf("Error opening database: %v\n", err)
-		s.entries = make(map[string]*LogStat)
+		s.mergeFlushBatch(batch)
+		log.Printf("=== Flush failed, kept %d entries in memory for the next flush ===\n", len(batch.entries))
 		return err
 	}
-	defer db.Close()
-
-	// Enable performance optimizations for SQLite
-	pragmas := []string{
-		"PRAGMA journal_mode=WAL",   // Write-Ahead Logging for better concurrency
-		"PRAGMA synchronous=NORMAL", // Faster writes with reasonable durability
-		"PRAGMA cache_size=-64000",  // 64MB cache
-		"PRAGMA temp_store=MEMORY",  // Use memory for temp tables
-	}
-	for _, pragma := range pragmas {
-		if _, err := db.Exec(pragma); err != nil {
-			log.Printf("Warning: failed to set pragma: %v\n", err)
+
+	s.recordFlushSuccess(len(batch.entries), time.Since(start))
+	log.Printf("    "+"FlushToDb took %v", time.Since(start))
+	log.Printf("=== Successfully flushed data to database ===\n")
+	log.Print("    " + GetMemoryStatsString())
+
+	return nil
+}
+
+// writeFlushBatch writes a detached batch: the buckets to the stats backend, patterns, exceptions, catalog
+// and search index in one database transaction. Parts already written are skipped when the batch is retried.
+func (s *LogStatStore) writeFlushBatch(batch *flushBatch) error {
+	if !batch.statsWritten {
+		stats := make([]*LogStat, 0, len(batch.entries))
+		for _, stat := range batch.entries {
+			stats = append(stats, stat)
+		}
+		if err := s.backend.UpsertStats(stats); err != nil {
+			return err
 		}
+		s.markStatsWritten(batch)
+
+		// The journal only holds bucket deltas, once they are persisted a crash must not replay them
+		if s.journal != nil {
+			s.journal.RemoveSegments(batch.journalSegments)
+		}
+		batch.journalSegments = nil
 	}
 
 	// Begin transaction for batch insert (HUGE performance boost)
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Printf("Error beginning transaction: %v\n", err)
-		s.entries = make(map[string]*LogStat)
 		return err
 	}
 
-	// Prepare statement once for reuse (performance optimization)
-	upsertSQL := `
-	INSERT INTO log_stats (hostname, bucket_ts, bucket_duration_s, level, logger, n, first_seen_ts)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
-	ON CONFLICT(hostname, bucket_ts, level, logger) 
-	DO UPDATE SET 
-		n = log_stats.n + excluded.n,
-		bucket_duration_s = excluded.bucket_duration_s,
-		first_seen_ts = CASE 
-			WHEN log_stats.first_seen_ts = '' THEN excluded.first_seen_ts
-			WHEN excluded.first_seen_ts = '' THEN log_stats.first_seen_ts
-			WHEN log_stats.first_seen_ts < excluded.first_seen_ts THEN log_stats.first_seen_ts
-			ELSE excluded.first_seen_ts
-		END;
-	`
-	stmt, err := tx.Prepare(upsertSQL)
-	if err != nil {
-		tx.Rollback()
-		log.Printf("Error preparing statement: %v\n", err)
-		s.entries = make(map[string]*LogStat)
-		return err
-	}
-	defer stmt.Close()
-
-	// Execute all inserts within the transaction
-	errorCount := 0
-	for _, stat := range s.entries {
-		if _, err := stmt.Exec(stat.HostName, stat.BucketTS, stat.BucketDuration_S, stat.Level, stat.Logger, stat.N, stat.FirstSeenTS); err != nil {
-			log.Printf("Error upserting log stat: %v\n", err)
-			errorCount++
+	// Write message pattern stats, exception stats, catalog metadata and the search index in the same
+	// transaction. Any error rolls back all of them, so the batch is retried or merged back as a whole.
+	for _, part := range []struct {
+		name  string
+		flush func(*sql.Tx, *flushBatch) error
+	}{
+		{"pattern stats", s.flushPatterns},
+		{"exception stats", s.flushExceptions},
+		{"catalog", s.flushCatalog},
+		{"search index", s.flushSearchDocs},
+	} {
+		if err := part.flush(tx, batch); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("flushing %s: %w", part.name, err)
 		}
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v\n", err)
-		s.entries = make(map[string]*LogStat)
 		return err
 	}
-
-	if errorCount > 0 {
-		log.Printf("Warning: %d errors occurred during flush\n", errorCount)
-	}
-
-	// Clear the store
-	s.entries = make(map[string]*LogStat)
-
-	log.Print("    " + GetMemoryStatsString())
+	s.commitFlushBatch(batch)
+	s.commitSearchFlush(batch)
 
 	return nil
 }
 
-// QueryDatabase retrieves all LogStat entries from the SQLite database
+// QueryDatabase retrieves all LogStat entries of the primary bucket size from the stats backend
 func (s *LogStatStore) QueryDatabase() ([]*LogStat, error) {
-	db, err := sql.Open("sqlite", s.dbPath)
-	if err != nil {
-		log.Printf("Error opening database: %v\n", err)
-		return nil, err
-	}
-	defer db.Close()
-
-	rows, err := db.Query("SELECT id, hostname, bucket_ts, bucket_duration_s, level, logger, n, first_seen_ts FROM log_stats ORDER BY bucket_ts DESC")
+	stats, err := s.backend.QueryStats(StatsQuery{BucketSize: int(s.bucketSize.Seconds())})
 	if err != nil {
 		log.Printf("Error querying database: %v\n", err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	var stats []*LogStat
-	for rows.Next() {
-		stat := &LogStat{}
-		if err := rows.Scan(&stat.ID, &stat.HostName, &stat.BucketTS, &stat.BucketDuration_S, &stat.Level, &stat.Logger, &stat.N, &stat.FirstSeenTS); err != nil {
-			log.Printf("Error scanning row: %v\n", err)
-			continue
-		}
-		stats = append(stats, stat)
-	}
-
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating rows: %v\n", err)
-		return nil, err
-	}
-
 	return stats, nil
 }
@@ -2,15 +2,22 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// maxLineLength is the maximum accepted length of a single log line
+const maxLineLength = 4 * 1024 * 1024
+
 // Version information (set by build script via ldflags)
 var (
 	Version   = "dev"
@@ -22,10 +29,42 @@ func main() {
 	// Define command-line flags
 	host := flag.String("host", "localhost", "Host to listen on")
 	tcpPort := flag.String("tcp-port", "3001", "TCP port for log receiver")
+	syslogTCPPort := flag.String("syslog-tcp-port", "", "TCP port for syslog receiver (empty = disabled)")
+	syslogUDPPort := flag.String("syslog-udp-port", "", "UDP port for syslog receiver (empty = disabled)")
+	gelfTCPPort := flag.String("gelf-tcp-port", "", "TCP port for GELF receiver (empty = disabled)")
+	gelfUDPPort := flag.String("gelf-udp-port", "", "UDP port for GELF receiver (empty = disabled)")
+	tlsCert := flag.String("tls-cert", "", "Server certificate file (PEM) to enable TLS on the TCP log receiver")
+	tlsKey := flag.String("tls-key", "", "Server private key file (PEM) for -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA bundle (PEM) to require and verify client certificates (mutual TLS)")
+	tlsHostMode := flag.String("tls-host-mode", HostIdentityOverride, "Use of client certificate CN as host identity: override, validate")
+	fieldMappingPath := flag.String("field-mapping", "", "JSON file with field mapping for incoming log entries (empty = built-in defaults)")
+	promoteFields := flag.String("promote-fields", "", "Comma-separated context fields appended to the logger name of the log stats as \":name=value\" (thread, ndc, loggerClassName, mdc.<key>, label.<key>); every distinct value adds a logger")
+	rulesFile := flag.String("rules-file", "", "JSON file with ingest rules, reloaded on change (empty = built-in timer rule)")
+	patternMining := flag.Bool("pattern-mining", false, "Enable message pattern mining (template clustering per logger)")
+	maxPatterns := flag.Int("max-patterns", 200, "Maximum number of message patterns per logger (further messages are counted as overflow)")
+	appPackages := flag.String("app-packages", "", "Comma-separated package prefixes of application frames used for stack trace fingerprints (empty = all non-framework frames)")
+	stackFrames := flag.Int("stack-frames", 5, "Number of top application frames in stack trace fingerprints")
 	httpPort := flag.String("http-port", "3000", "HTTP port for web interface and WebSocket")
 	dbPath := flag.String("db-path", "log_stat.db", "Path to SQLite database file")
 	bucketSize := flag.Duration("bucket-size", 1*time.Minute, "Time bucket size (1m, 5m, 10m, 15m, 20m, 30m, 60m)")
 	retentionDays := flag.Int("retention-days", 7, "Number of days to retain data in database")
+	extraBuckets := flag.String("extra-buckets", "", "Additional bucket resolutions maintained in parallel as size:retentionDays pairs, e.g. 15m:90,60m:365")
+	hourlyRetentionDays := flag.Int("hourly-retention-days", 90, "Number of days to retain hourly rollups (0 = no hourly rollup)")
+	dailyRetentionDays := flag.Int("daily-retention-days", 730, "Number of days to retain daily rollups (0 = no daily rollup)")
+	lateWindow := flag.Duration("late-window", 15*time.Minute, "Entries with event timestamps older than this are handled as late (0 = disabled)")
+	latePolicy := flag.String("late-policy", LatePolicyUpsert, "Handling of late entries: upsert (event time bucket), arrival (arrival time bucket), drop")
+	journalPath := flag.String("journal-path", "", "Append-only journal of in-memory counts, replayed on startup after a crash (empty = disabled)")
+	journalSync := flag.String("journal-sync", JournalSyncInterval, "Journal fsync policy: always, interval, none")
+	journalSyncInterval := flag.Duration("journal-sync-interval", 1*time.Second, "Journal fsync interval for -journal-sync interval")
+	backend := flag.String("backend", "sqlite", "Storage backend of the log stat buckets: sqlite, columnar")
+	columnarDir := flag.String("columnar-dir", "log_stat_columnar", "Directory of the columnar backend (partitioned column files per bucket size and day)")
+	archiveDir := flag.String("archive-dir", "", "Directory of the raw message archive (empty = disabled)")
+	archiveRetentionDays := flag.Int("archive-retention-days", 7, "Number of days to retain archived raw messages")
+	archiveSegment := flag.Duration("archive-segment", 1*time.Hour, "Time after which an archive segment is sealed and a new one started")
+	searchMinLevel := flag.String("search-min-level", "", "Minimum level of messages added to the full-text search index, e.g. WARN (empty = disabled)")
+	searchLoggerRegex := flag.String("search-logger-regex", "", "Regex on the logger name of messages added to the full-text search index (empty = all loggers)")
+	searchRetentionDays := flag.Int("search-retention-days", 7, "Number of days to retain messages in the full-text search index")
+	migrateOnly := flag.Bool("migrate-only", false, "Migrate the database to the current schema version and exit")
 	verbose := flag.Bool("verbose", false, "Enable verbose output")
 	version := flag.Bool("version", false, "Show version information")
 	flag.Parse()
@@ -44,23 +83,36 @@ func main() {
 	httpAddr := *host + ":" + *httpPort
 
 	// Validate bucket size
-	validSizes := map[time.Duration]bool{
-		1 * time.Minute:  true,
-		5 * time.Minute:  true,
-		10 * time.Minute: true,
-		15 * time.Minute: true,
-		20 * time.Minute: true,
-		30 * time.Minute: true,
-		60 * time.Minute: true,
-	}
-	if !validSizes[*bucketSize] {
+	if !validBucketSizes[*bucketSize] {
 		log.Fatal("Invalid bucket size. Allowed values: 1m, 5m, 10m, 15m, 20m, 30m, 60m")
 	}
 
+	// Primary resolution first, then the additional ones
+	resolutions := []BucketResolution{{Size: *bucketSize, RetentionDays: *retentionDays}}
+	extraResolutions, parseErr := ParseBucketResolutions(*extraBuckets)
+	if parseErr != nil {
+		log.Fatal(parseErr)
+	}
+	for _, res := range extraResolutions {
+		if res.Size == *bucketSize {
+			log.Fatalf("Extra bucket size %v equals the primary bucket size", res.Size)
+		}
+		for _, existing := range resolutions {
+			if existing.Size == res.Size {
+				log.Fatalf("Duplicate extra bucket size %v", res.Size)
+			}
+		}
+		resolutions = append(resolutions, res)
+	}
+
 	log.Println("=== WildFly Log Receiver/Reporter ===")
 	log.Println("=== Starting LogIngest Server on " + tcpAddr + " ===")
 	log.Println("=== Starting LogStat HTTP Server on " + httpAddr + " ===")
 	log.Printf("=== Bucket size: %v ===\n", *bucketSize)
+	for _, res := range extraResolutions {
+		log.Printf("=== Extra bucket size: %v (retention %d days) ===\n", res.Size, res.RetentionDays)
+	}
+	log.Printf("=== Late window: %v (policy: %s) ===\n", *lateWindow, *latePolicy)
 
 	// Create WebSocket hub (max 20 clients)
 	hub := NewHub(20)
@@ -71,27 +123,195 @@ func main() {
 	// Create log stat store with bucket size and hub reference
 	store := NewLogStatStore(*bucketSize, *dbPath, *verbose)
 	store.hub = hub // Set hub reference for broadcasting
+	store.resolutions = resolutions
+	store.rollupTiers = nil
+	for _, tier := range DefaultRollupTiers(*hourlyRetentionDays, *dailyRetentionDays) {
+		if tier.RetentionDays > 0 {
+			store.rollupTiers = append(store.rollupTiers, tier)
+		}
+	}
+	if err := store.SetLateArrivalPolicy(*lateWindow, *latePolicy); err != nil {
+		log.Fatal(err)
+	}
+	if *fieldMappingPath != "" {
+		mapping, err := LoadFieldMapping(*fieldMappingPath)
+		if err != nil {
+			log.Fatalf("Failed to load field mapping: %v", err)
+		}
+		store.fieldMapping = mapping
+		log.Printf("=== Field mapping loaded from %s ===\n", *fieldMappingPath)
+	}
+	if *rulesFile != "" {
+		rules, err := LoadRuleEngine(*rulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load ingest rules: %v", err)
+		}
+		store.rules = rules
+		go rules.Watch(10 * time.Second)
+		log.Printf("=== Loaded %d ingest rules from %s ===\n", len(rules.GetRules()), *rulesFile)
+	} else {
+		rules, err := NewRuleEngine(DefaultIngestRules())
+		if err != nil {
+			log.Fatalf("Failed to compile built-in ingest rules: %v", err)
+		}
+		store.rules = rules
+	}
+	for _, field := range strings.Split(*promoteFields, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case field == "thread", field == "ndc", field == "loggerClassName", strings.HasPrefix(field, "mdc."), strings.HasPrefix(field, "label."):
+			store.promotedFields = append(store.promotedFields, field)
+		default:
+			log.Fatalf("Invalid promote field %q. Allowed values: thread, ndc, loggerClassName, mdc.<key>, label.<key>", field)
+		}
+	}
+
+	var packages []string
+	for _, pkg := range strings.Split(*appPackages, ",") {
+		if pkg = strings.TrimSpace(pkg); pkg != "" {
+			packages = append(packages, pkg)
+		}
+	}
+	store.fingerprinter = NewStackFingerprinter(packages, *stackFrames)
+
+	// Select the stats backend (opened by InitDB)
+	switch *backend {
+	case "sqlite":
+	case "columnar":
+		store.columnarDir = *columnarDir
+	default:
+		log.Fatal("Invalid backend. Allowed values: sqlite, columnar")
+	}
+	store.backendName = *backend
 
 	// Initialize database
 	if err := store.InitDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
+	if *migrateOnly {
+		log.Println("=== Migration complete (-migrate-only) ===")
+		store.CloseDB()
+		os.Exit(0)
+	}
+	if *patternMining {
+		if err := store.EnablePatternMining(*maxPatterns); err != nil {
+			log.Fatalf("Failed to enable pattern mining: %v", err)
+		}
+		log.Printf("=== Pattern mining enabled (max %d patterns per logger) ===\n", *maxPatterns)
+	}
+	if *journalPath != "" {
+		if err := store.EnableJournal(*journalPath, *journalSync); err != nil {
+			log.Fatalf("Failed to enable journal: %v", err)
+		}
+		go store.journal.RunSync(*journalSyncInterval)
+		log.Printf("=== Journal enabled: %s (sync: %s) ===\n", *journalPath, *journalSync)
+	}
+	if *archiveDir != "" {
+		if err := store.EnableArchive(*archiveDir, *archiveSegment, *archiveRetentionDays); err != nil {
+			log.Fatalf("Failed to enable raw archive: %v", err)
+		}
+		go store.archive.Run()
+		log.Printf("=== Raw archive enabled: %s (retention %d days) ===\n", *archiveDir, *archiveRetentionDays)
+	}
+	if *searchMinLevel != "" {
+		if err := store.EnableMessageSearch(*searchMinLevel, *searchLoggerRegex, *searchRetentionDays); err != nil {
+			log.Fatalf("Failed to enable message search: %v", err)
+		}
+		log.Printf("=== Message search enabled: %s and above (retention %d days) ===\n", store.search.minLevel, *searchRetentionDays)
+	}
 
-	// Start TCP listener for logs
-	listener, err := net.Listen("tcp", tcpAddr)
+	// Start TCP listener for logs (optionally TLS)
+	if *tlsHostMode != HostIdentityOverride && *tlsHostMode != HostIdentityValidate {
+		log.Fatal("Invalid tls-host-mode. Allowed values: override, validate")
+	}
+	store.hostIdentityMode = *tlsHostMode
+
+	var listener net.Listener
+	var err error
+	if *tlsCert != "" {
+		tlsConfig, tlsErr := loadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if tlsErr != nil {
+			log.Fatalf("Failed to configure TLS: %v", tlsErr)
+		}
+		listener, err = tls.Listen("tcp", tcpAddr, tlsConfig)
+		log.Printf("=== TLS enabled on log receiver (client certificates: %v) ===", *tlsClientCA != "")
+	} else {
+		if *tlsClientCA != "" {
+			log.Fatal("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		listener, err = net.Listen("tcp", tcpAddr)
+	}
 	if err != nil {
 		log.Fatal("Failed to listen on TCP:", err)
 	}
 	defer listener.Close()
 
+	// Start optional syslog listeners
+	if *syslogTCPPort != "" {
+		if err := StartSyslogTCP(*host+":"+*syslogTCPPort, store, *verbose); err != nil {
+			log.Fatal("Failed to listen on syslog TCP:", err)
+		}
+		log.Println("=== Starting Syslog TCP receiver on " + *host + ":" + *syslogTCPPort + " ===")
+	}
+	if *syslogUDPPort != "" {
+		if err := StartSyslogUDP(*host+":"+*syslogUDPPort, store); err != nil {
+			log.Fatal("Failed to listen on syslog UDP:", err)
+		}
+		log.Println("=== Starting Syslog UDP receiver on " + *host + ":" + *syslogUDPPort + " ===")
+	}
+
+	// Start optional GELF listeners
+	if *gelfTCPPort != "" {
+		if err := StartGelfTCP(*host+":"+*gelfTCPPort, store, *verbose); err != nil {
+			log.Fatal("Failed to listen on GELF TCP:", err)
+		}
+		log.Println("=== Starting GELF TCP receiver on " + *host + ":" + *gelfTCPPort + " ===")
+	}
+	if *gelfUDPPort != "" {
+		if err := StartGelfUDP(*host+":"+*gelfUDPPort, store, *verbose); err != nil {
+			log.Fatal("Failed to listen on GELF UDP:", err)
+		}
+		log.Println("=== Starting GELF UDP receiver on " + *host + ":" + *gelfUDPPort + " ===")
+	}
+
 	// Create app config
 	config := &AppConfig{
 		Host:          *host,
 		TCPPort:       *tcpPort,
+		SyslogTCPPort: *syslogTCPPort,
+		SyslogUDPPort: *syslogUDPPort,
+		GelfTCPPort:   *gelfTCPPort,
+		GelfUDPPort:   *gelfUDPPort,
+		TLSEnabled:    *tlsCert != "",
+		TLSClientAuth: *tlsClientCA != "",
+		TLSHostMode:   *tlsHostMode,
+		FieldMapping:  *fieldMappingPath,
+		PromoteFields: *promoteFields,
+		RulesFile:     *rulesFile,
+		PatternMining: *patternMining,
+		MaxPatterns:   *maxPatterns,
+		AppPackages:   *appPackages,
+		StackFrames:   *stackFrames,
 		HTTPPort:      *httpPort,
 		DBPath:        *dbPath,
 		BucketSize:    bucketSize.String(),
 		RetentionDays: *retentionDays,
+		ExtraBuckets:  *extraBuckets,
+		HourlyDays:    *hourlyRetentionDays,
+		DailyDays:     *dailyRetentionDays,
+		LateWindow:    lateWindow.String(),
+		LatePolicy:    *latePolicy,
+		JournalPath:   *journalPath,
+		JournalSync:   *journalSync,
+		Backend:       *backend,
+		ArchiveDir:    *archiveDir,
+		ArchiveDays:   *archiveRetentionDays,
+		ColumnarDir:   *columnarDir,
+		SearchLevel:   *searchMinLevel,
+		SearchLoggers: *searchLoggerRegex,
+		SearchDays:    *searchRetentionDays,
 		Verbose:       *verbose,
 	}
 
@@ -120,20 +340,27 @@ func main() {
 		listener.Close()
 		store.PrintSummary()
 		store.FlushToDb()
+		if store.journal != nil {
+			store.journal.Close()
+		}
+		if store.archive != nil {
+			store.archive.Close()
+		}
+		store.CloseDB()
 		os.Exit(0)
 	}()
 
 	// Start periodic database maintenance
 	go func() {
 		// Run immediately on startup
-		RunMaintenance(*dbPath, *retentionDays)
+		RunMaintenance(store.backend, store.db, store.resolutions, store.rollupTiers, *searchRetentionDays)
 
 		// Then run every 3 hours
 		ticker := time.NewTicker(3 * time.Hour)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			RunMaintenance(*dbPath, *retentionDays)
+			RunMaintenance(store.backend, store.db, store.resolutions, store.rollupTiers, *searchRetentionDays)
 		}
 	}()
 
@@ -156,15 +383,35 @@ func handleConnection(conn net.Conn, verbose bool, store *LogStatStore) {
 	defer conn.Close()
 
 	remoteAddr := conn.RemoteAddr().String()
-	scanner := bufio.NewScanner(conn)
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	// Client certificate CN is used as trusted host identity
+	trustedHost, err := tlsPeerIdentity(conn)
+	if err != nil {
+		log.Printf("TLS handshake with %s failed: %v\n", remoteAddr, err)
+		return
+	}
+	if trustedHost != "" && verbose {
+		log.Printf("Client %s authenticated as %s\n", remoteAddr, trustedHost)
+	}
+
+	reader := bufio.NewReaderSize(conn, 64*1024)
 
-		store.handleJsonLogEntry(line)
+	for {
+		var line []byte
+		var tooLong bool
+		line, tooLong, err = readLine(reader, maxLineLength)
+		if tooLong {
+			// Quarantine oversized lines but keep the connection alive
+			store.rejected.Add(remoteAddr, string(line), fmt.Errorf("line exceeds %d bytes", maxLineLength))
+		} else if len(line) > 0 {
+			store.handleJsonLogEntry(string(line), remoteAddr, trustedHost)
+		}
+		if err != nil {
+			break
+		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err != io.EOF {
 		if verbose {
 			log.Printf("Connection error from %s: %v\n", remoteAddr, err)
 		}
@@ -174,3 +421,22 @@ func handleConnection(conn net.Conn, verbose bool, store *LogStatStore) {
 		log.Printf("Connection closed: %s\n", remoteAddr)
 	}
 }
+
+// readLine reads a single newline terminated line. Lines longer than maxLen are consumed
+// completely but only the first maxLen bytes are returned and tooLong is set.
+func readLine(reader *bufio.Reader, maxLen int) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, isPrefix, readErr := reader.ReadLine()
+		if len(line)+len(chunk) > maxLen {
+			tooLong = true
+			if room := maxLen - len(line); room > 0 {
+				line = append(line, chunk[:room]...)
+			}
+		} else {
+			line = append(line, chunk...)
+		}
+		if readErr != nil || !isPrefix {
+			return line, tooLong, readErr
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Message search limits
+const (
+	searchMaxPending    = 100000 // selected messages queued between flushes, further ones are dropped
+	searchMaxResults    = 1000   // upper limit of search hits
+	searchSnippetTokens = 16     // tokens per snippet
+)
+
+// errInvalidSearchQuery is returned for invalid search parameters and full-text queries SQLite rejects
+var errInvalidSearchQuery = errors.New("invalid search query")
+
+// searchDoc is a selected message queued for the full-text index until the next flush
+type searchDoc struct {
+	Timestamp  time.Time
+	Host       string
+	Level      string
+	Logger     string
+	Message    string
+	StackTrace string
+}
+
+// MessageSearch selects the messages added to the full-text index. Counters are guarded by the store mutex.
+type MessageSearch struct {
+	minLevel      string
+	minSeverity   int
+	loggerRegex   *regexp.Regexp // nil = all loggers
+	retentionDays int
+	dimensions    *dimensionCache
+	indexed       int64 // messages written to the index
+	dropped       int64 // messages dropped because the queue was full
+}
+
+// SearchQuery describes a full-text search. Query uses the FTS5 syntax: terms, "phrases", prefix*,
+// AND/OR/NOT, NEAR(...) and column filters (message: or stack_trace:).
+type SearchQuery struct {
+	Query       string
+	StartTime   time.Time // zero = unbounded
+	EndTime     time.Time // exclusive, zero = unbounded
+	Host        string
+	Level       string
+	LoggerRegex string
+	Order       string        // "time" (newest first) or "rank" (best match first)
+	Bucket      time.Duration // histogram bucket size
+	MaxResults  int
+}
+
+// SearchHit is a message matching a search
+type SearchHit struct {
+	ID                int64  `json:"id"`
+	Timestamp         string `json:"timestamp"`
+	Host              string `json:"host"`
+	Level             string `json:"level"`
+	Logger            string `json:"logger"`
+	Message           string `json:"message"`
+	Snippet           string `json:"snippet"`                       // message excerpt, matches wrapped in <mark></mark>
+	StackTraceSnippet string `json:"stack_trace_snippet,omitempty"` // only if the stack trace matches
+}
+
+// SearchHistogramBucket counts the hits of a search in one time bucket
+type SearchHistogramBucket struct {
+	BucketTS string `json:"bucket_ts"`
+	N        int64  `json:"n"`
+}
+
+// SearchResult holds the hits and the hit histogram of a search
+type SearchResult struct {
+	Total        int64                    `json:"total"` // all hits, not limited by max_results
+	Hits         []*SearchHit             `json:"hits"`
+	Truncated    bool                     `json:"truncated"` // more hits than returned
+	BucketSize_S int                      `json:"bucket_size_s"`
+	Histogram    []*SearchHistogramBucket `json:"histogram"` // buckets with hits, oldest first
+	Pending      int                      `json:"pending"`   // selected messages searchable after the next flush
+}
+
+// EnableMessageSearch adds messages of at least minLevel (and matching loggerRegex, if given) to the
+// full-text index. Indexed messages are kept for retentionDays.
+func (s *LogStatStore) EnableMessageSearch(minLevel, loggerRegex string, retentionDays int) error {
+	severity := levelSeverity(minLevel)
+	if severity < 0 {
+		return fmt.Errorf("invalid search level %q. Allowed values: TRACE, DEBUG, INFO, WARN, ERROR, FATAL", minLevel)
+	}
+	regex, err := compileLoggerRegex(loggerRegex)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.search = &MessageSearch{
+		minLevel:      strings.ToUpper(minLevel),
+		minSeverity:   severity,
+		loggerRegex:   regex,
+		retentionDays: retentionDays,
+		dimensions:    newDimensionCache(),
+	}
+	return nil
+}
+
+// addSearchDoc queues an entry for the full-text index if it is selected
+func (s *LogStatStore) addSearchDoc(entry *RawLogEntry) {
+	if levelSeverity(entry.Level) < s.search.minSeverity {
+		return
+	}
+	if s.search.loggerRegex != nil && !s.search.loggerRegex.MatchString(entry.Logger) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.searchDocs) >= searchMaxPending {
+		s.search.dropped++
+		return
+	}
+	s.searchDocs = append(s.searchDocs, &searchDoc{
+		Timestamp:  entry.Timestamp,
+		Host:       entry.Host,
+		Level:      entry.Level,
+		Logger:     entry.Logger,
+		Message:    entry.Message,
+		StackTrace: entry.StackTrace,
+	})
+}
+
+// flushSearchDocs writes the queued messages of a flush batch to the full-text index within the
+// flush transaction. Dimension IDs resolved here are cached by commitSearchFlush. The first error is
+// returned, so the transaction rolls back and the messages are retried or merged back with the batch.
+func (s *LogStatStore) flushSearchDocs(tx *sql.Tx, batch *flushBatch) error {
+	batch.searchDimensions = make(map[string]map[string]int64)
+	batch.searchIndexed = 0
+	if s.search == nil || len(batch.searchDocs) == 0 {
+		return nil
+	}
+
+	messageStmt, err := tx.Prepare("INSERT INTO search_messages (ts_ms, host_id, level_id, logger_id) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer messageStmt.Close()
+
+	textStmt, err := tx.Prepare("INSERT INTO search_fts (rowid, message, stack_trace) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer textStmt.Close()
+
+	for _, doc := range batch.searchDocs {
+		hostID, err := s.search.dimensions.resolve(tx, "hosts", doc.Host, batch.searchDimensions)
+		if err != nil {
+			return fmt.Errorf("resolving search host: %w", err)
+		}
+		levelID, err := s.search.dimensions.resolve(tx, "levels", doc.Level, batch.searchDimensions)
+		if err != nil {
+			return fmt.Errorf("resolving search level: %w", err)
+		}
+		loggerID, err := s.search.dimensions.resolve(tx, "loggers", doc.Logger, batch.searchDimensions)
+		if err != nil {
+			return fmt.Errorf("resolving search logger: %w", err)
+		}
+
+		// Metadata and text rows are written together or rolled back together
+		result, err := messageStmt.Exec(doc.Timestamp.UnixMilli(), hostID, levelID, loggerID)
+		if err != nil {
+			return fmt.Errorf("inserting search message: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("inserting search message: %w", err)
+		}
+		if _, err := textStmt.Exec(id, doc.Message, doc.StackTrace); err != nil {
+			return fmt.Errorf("indexing search message: %w", err)
+		}
+		batch.searchIndexed++
+	}
+
+	return nil
+}
+
+// commitSearchFlush caches the dimension IDs and counts the messages of a committed flush
+func (s *LogStatStore) commitSearchFlush(batch *flushBatch) {
+	if s.search == nil {
+		return
+	}
+	s.search.dimensions.commit(batch.searchDimensions)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.search.indexed += int64(batch.searchIndexed)
+}
+
+// GetSearchStats returns the message search configuration and counters
+func (s *LogStatStore) GetSearchStats() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	loggerRegex := ""
+	if s.search.loggerRegex != nil {
+		loggerRegex = s.search.loggerRegex.String()
+	}
+
+	return map[string]interface{}{
+		"min_level":      s.search.minLevel,
+		"logger_regex":   loggerRegex,
+		"retention_days": s.search.retentionDays,
+		"pending":        len(s.searchDocs),
+		"indexed":        s.search.indexed,
+		"dropped":        s.search.dropped,
+	}
+}
+
+// SearchMessages runs a full-text search over the indexed messages. Messages are searchable after the
+// flush following their arrival.
+func (s *LogStatStore) SearchMessages(q SearchQuery) (*SearchResult, error) {
+	if strings.TrimSpace(q.Query) == "" {
+		return nil, fmt.Errorf("%w: empty query", errInvalidSearchQuery)
+	}
+	if q.Order != "time" && q.Order != "rank" {
+		return nil, fmt.Errorf("%w: order %q (allowed: time, rank)", errInvalidSearchQuery, q.Order)
+	}
+	if q.Bucket < time.Minute || q.Bucket > 24*time.Hour || q.Bucket%time.Minute != 0 {
+		return nil, fmt.Errorf("%w: bucket %v (whole minutes between 1m and 24h)", errInvalidSearchQuery, q.Bucket)
+	}
+	if q.MaxResults <= 0 || q.MaxResults > searchMaxResults {
+		q.MaxResults = searchMaxResults
+	}
+	if _, err := compileLoggerRegex(q.LoggerRegex); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSearchQuery, err)
+	}
+
+	s.mu.RLock()
+	pending := len(s.searchDocs)
+	s.mu.RUnlock()
+
+	result := &SearchResult{
+		Hits:         []*SearchHit{},
+		BucketSize_S: int(q.Bucket.Seconds()),
+		Pending:      pending,
+	}
+
+	where, args := searchWhereClause(q)
+
+	// Hit histogram, counted per minute in SQL and rebucketed here
+	histogram := make(map[string]*SearchHistogramBucket)
+	rows, err := s.db.Query(`
+	SELECT m.ts_ms / 60000, COUNT(*)
+	`+searchFromClause+where+`
+	GROUP BY m.ts_ms / 60000`, args...)
+	if err != nil {
+		return nil, searchQueryError(err)
+	}
+	for rows.Next() {
+		var minute, n int64
+		if err := rows.Scan(&minute, &n); err != nil {
+			log.Printf("Error scanning search histogram row: %v\n", err)
+			continue
+		}
+		bucketTS := getBucketTime(time.UnixMilli(minute*60000).Local(), q.Bucket).Format(time.RFC3339)
+		if bucket, exists := histogram[bucketTS]; exists {
+			bucket.N += n
+		} else {
+			histogram[bucketTS] = &SearchHistogramBucket{BucketTS: bucketTS, N: n}
+		}
+		result.Total += n
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, searchQueryError(err)
+	}
+
+	result.Histogram = make([]*SearchHistogramBucket, 0, len(histogram))
+	for _, bucket := range histogram {
+		result.Histogram = append(result.Histogram, bucket)
+	}
+	sort.Slice(result.Histogram, func(i, j int) bool {
+		return result.Histogram[i].BucketTS < result.Histogram[j].BucketTS
+	})
+
+	// Hits with snippets
+	order := " ORDER BY m.ts_ms DESC, m.id DESC"
+	if q.Order == "rank" {
+		order = " ORDER BY search_fts.rank"
+	}
+	snippetArgs := fmt.Sprintf("'<mark>', '</mark>', '…', %d", searchSnippetTokens)
+	rows, err = s.db.Query(`
+	SELECT m.id, m.ts_ms, h.name, l.name, g.name, search_fts.message,
+		snippet(search_fts, 0, `+snippetArgs+`),
+		snippet(search_fts, 1, `+snippetArgs+`)
+	`+searchFromClause+where+order+" LIMIT ?", append(args, q.MaxResults+1)...)
+	if err != nil {
+		return nil, searchQueryError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hit := &SearchHit{}
+		var tsMs int64
+		var stackSnippet string
+		if err := rows.Scan(&hit.ID, &tsMs, &hit.Host, &hit.Level, &hit.Logger, &hit.Message, &hit.Snippet, &stackSnippet); err != nil {
+			log.Printf("Error scanning search hit: %v\n", err)
+			continue
+		}
+		if len(result.Hits) == q.MaxResults {
+			result.Truncated = true
+			break
+		}
+
+		hit.Timestamp = time.UnixMilli(tsMs).Local().Format(time.RFC3339Nano)
+		if strings.Contains(stackSnippet, "<mark>") {
+			hit.StackTraceSnippet = stackSnippet
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, searchQueryError(err)
+	}
+
+	return result, nil
+}
+
+// searchFromClause joins the full-text index with time and dimensions of the messages
+const searchFromClause = `
+	FROM search_fts
+	JOIN search_messages m ON m.id = search_fts.rowid
+	JOIN hosts h ON h.id = m.host_id
+	JOIN levels l ON l.id = m.level_id
+	JOIN loggers g ON g.id = m.logger_id`
+
+// searchWhereClause builds the WHERE clause of a search
+func searchWhereClause(q SearchQuery) (string, []interface{}) {
+	where := " WHERE search_fts MATCH ?"
+	args := []interface{}{q.Query}
+
+	if !q.StartTime.IsZero() {
+		where += " AND m.ts_ms >= ?"
+		args = append(args, q.StartTime.UnixMilli())
+	}
+	if !q.EndTime.IsZero() {
+		where += " AND m.ts_ms < ?"
+		args = append(args, q.EndTime.UnixMilli())
+	}
+	if q.Host != "" {
+		where += " AND h.name = ?"
+		args = append(args, q.Host)
+	}
+	if q.Level != "" {
+		where += " AND l.name = ?"
+		args = append(args, q.Level)
+	}
+
+	if q.LoggerRegex != "" {
+		condition, regexArgs := regexCondition("g.name", q.LoggerRegex)
+		where += condition
+		args = append(args, regexArgs...)
+	}
+
+	return where, args
+}
+
+// searchQueryError marks errors caused by the full-text query syntax
+func searchQueryError(err error) error {
+	for _, marker := range []string{"fts5", "no such column", "unterminated string"} {
+		if strings.Contains(err.Error(), marker) {
+			return fmt.Errorf("%w: %v", errInvalidSearchQuery, err)
+		}
+	}
+	return err
+}
+
+// CleanupSearchIndex deletes indexed messages older than the retention period
+func CleanupSearchIndex(db *sql.DB, retentionDays int) error {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays).UnixMilli()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM search_fts WHERE rowid IN (SELECT id FROM search_messages WHERE ts_ms < ?)", cutoff); err != nil {
+		log.Printf("    "+"Error cleaning up old search index entries: %v\n", err)
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM search_messages WHERE ts_ms < ?", cutoff)
+	if err != nil {
+		log.Printf("    "+"Error cleaning up old search messages: %v\n", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	deleted, _ := result.RowsAffected()
+	log.Printf("    "+"Cleanup: deleted %d indexed messages\n", deleted)
+	return nil
+}
@@ -9,6 +9,7 @@ type LogStat struct {
 	BucketTS         string // bucket start time (RFC3339 format, aligned to clock)
 	FirstSeenTS      string // timestamp of the first message in this bucket
 	BucketDuration_S int    // actual duration of this bucket in seconds (may be less for first bucket)
+	BucketSize_S     int    // configured bucket size (resolution) in seconds
 	Level            string // log level (8 character string)
 	Logger           string // logger name
 	N                int    // counter of occurrences in this bucket
@@ -20,6 +21,27 @@ func (ls *LogStat) String() string {
 		ls.ID, ls.HostName, ls.BucketTS, ls.FirstSeenTS, ls.BucketDuration_S, ls.Level, ls.Logger, ls.N)
 }
 
+// PatternStat counts occurrences of a message pattern in a time bucket
+type PatternStat struct {
+	HostName    string `json:"hostname"`
+	BucketTS    string `json:"bucket_ts"`
+	Level       string `json:"level"`
+	Logger      string `json:"logger"`
+	PatternID   string `json:"pattern_id"`
+	N           int    `json:"n"`
+	FirstSeenTS string `json:"first_seen_ts"`
+}
+
+// ExceptionStat counts occurrences of a stack trace fingerprint in a time bucket
+type ExceptionStat struct {
+	Fingerprint string
+	HostName    string
+	Logger      string
+	Level       string
+	BucketTS    string
+	N           int
+}
+
 // SystemInfo represents runtime and memory statistics
 type SystemInfo struct {
 	Hostname     string `json:"hostname"`
@@ -57,9 +79,37 @@ type SystemInfo struct {
 type AppConfig struct {
 	Host          string `json:"host"`
 	TCPPort       string `json:"tcp_port"`
+	SyslogTCPPort string `json:"syslog_tcp_port"`
+	SyslogUDPPort string `json:"syslog_udp_port"`
+	GelfTCPPort   string `json:"gelf_tcp_port"`
+	GelfUDPPort   string `json:"gelf_udp_port"`
+	TLSEnabled    bool   `json:"tls_enabled"`
+	TLSClientAuth bool   `json:"tls_client_auth"`
+	TLSHostMode   string `json:"tls_host_mode"`
+	FieldMapping  string `json:"field_mapping"`
+	PromoteFields string `json:"promote_fields"`
+	RulesFile     string `json:"rules_file"`
+	PatternMining bool   `json:"pattern_mining"`
+	MaxPatterns   int    `json:"max_patterns_per_logger"`
+	AppPackages   string `json:"app_packages"`
+	StackFrames   int    `json:"stack_frames"`
 	HTTPPort      string `json:"http_port"`
 	DBPath        string `json:"db_path"`
 	BucketSize    string `json:"bucket_size"`
 	RetentionDays int    `json:"retention_days"`
+	ExtraBuckets  string `json:"extra_buckets"`
+	HourlyDays    int    `json:"hourly_retention_days"`
+	DailyDays     int    `json:"daily_retention_days"`
+	LateWindow    string `json:"late_window"`
+	LatePolicy    string `json:"late_policy"`
+	JournalPath   string `json:"journal_path"`
+	JournalSync   string `json:"journal_sync"`
+	Backend       string `json:"backend"`
+	ArchiveDir    string `json:"archive_dir"`
+	ArchiveDays   int    `json:"archive_retention_days"`
+	ColumnarDir   string `json:"columnar_dir"`
+	SearchLevel   string `json:"search_min_level"`
+	SearchLoggers string `json:"search_logger_regex"`
+	SearchDays    int    `json:"search_retention_days"`
 	Verbose       bool   `json:"verbose"`
 }
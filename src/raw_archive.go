@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Raw archive files
+const (
+	archiveSegmentExt  = ".jsonl.gz"
+	archiveIndexExt    = ".idx.json"
+	archiveMaxResults  = 1000 // upper limit of search results
+	archiveSegmentSize = 64 * 1024 * 1024
+)
+
+// ArchivedLogEntry is a raw log message as stored in the archive
+type ArchivedLogEntry struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Host       string            `json:"host"`
+	Level      string            `json:"level"`
+	Logger     string            `json:"logger"`
+	Message    string            `json:"message"`
+	StackTrace string            `json:"stack_trace,omitempty"`
+	Thread     string            `json:"thread,omitempty"`
+	NDC        string            `json:"ndc,omitempty"`
+	MDC        map[string]string `json:"mdc,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	PatternID  string            `json:"pattern_id,omitempty"`
+}
+
+// archiveIndex describes the messages of a segment, so searches only read matching segments
+type archiveIndex struct {
+	MinTS   time.Time      `json:"min_ts"` // earliest message timestamp
+	MaxTS   time.Time      `json:"max_ts"` // latest message timestamp
+	Count   int            `json:"count"`
+	Hosts   map[string]int `json:"hosts"`
+	Levels  map[string]int `json:"levels"`
+	Loggers map[string]int `json:"loggers"`
+}
+
+func newArchiveIndex() *archiveIndex {
+	return &archiveIndex{
+		Hosts:   make(map[string]int),
+		Levels:  make(map[string]int),
+		Loggers: make(map[string]int),
+	}
+}
+
+// add counts a message in the index
+func (idx *archiveIndex) add(entry *ArchivedLogEntry) {
+	if idx.Count == 0 || entry.Timestamp.Before(idx.MinTS) {
+		idx.MinTS = entry.Timestamp
+	}
+	if idx.Count == 0 || entry.Timestamp.After(idx.MaxTS) {
+		idx.MaxTS = entry.Timestamp
+	}
+	idx.Count++
+	idx.Hosts[entry.Host]++
+	idx.Levels[entry.Level]++
+	idx.Loggers[entry.Logger]++
+}
+
+// ArchiveQuery selects archived messages
+type ArchiveQuery struct {
+	StartTime   time.Time // inclusive (zero = no start limit)
+	EndTime     time.Time // exclusive (zero = no end limit)
+	Host        string    // exact host (empty = all hosts)
+	Level       string    // exact level (empty = all levels)
+	LoggerRegex string    // regex matching logger names (empty = all loggers)
+	Text        string    // case-insensitive substring of message or stack trace (empty = all)
+	MaxResults  int       // maximum number of messages, earliest first (0 or above archiveMaxResults = archiveMaxResults)
+}
+
+// matchesIndex reports whether a segment may contain matching messages
+func (q ArchiveQuery) matchesIndex(idx *archiveIndex, loggerRegex *regexp.Regexp) bool {
+	if idx.Count == 0 {
+		return false
+	}
+	if !q.StartTime.IsZero() && idx.MaxTS.Before(q.StartTime) {
+		return false
+	}
+	if !q.EndTime.IsZero() && !idx.MinTS.Before(q.EndTime) {
+		return false
+	}
+	if q.Host != "" && idx.Hosts[q.Host] == 0 {
+		return false
+	}
+	if q.Level != "" && idx.Levels[q.Level] == 0 {
+		return false
+	}
+	if loggerRegex != nil {
+		for logger := range idx.Loggers {
+			if loggerRegex.MatchString(logger) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matches reports whether a message matches the query
+func (q ArchiveQuery) matches(entry *ArchivedLogEntry, loggerRegex *regexp.Regexp, text string) bool {
+	if !q.StartTime.IsZero() && entry.Timestamp.Before(q.StartTime) {
+		return false
+	}
+	if !q.EndTime.IsZero() && !entry.Timestamp.Before(q.EndTime) {
+		return false
+	}
+	if q.Host != "" && entry.Host != q.Host {
+		return false
+	}
+	if q.Level != "" && entry.Level != q.Level {
+		return false
+	}
+	if loggerRegex != nil && !loggerRegex.MatchString(entry.Logger) {
+		return false
+	}
+	if text != "" && !strings.Contains(strings.ToLower(entry.Message), text) && !strings.Contains(strings.ToLower(entry.StackTrace), text) {
+		return false
+	}
+	return true
+}
+
+// ArchiveSearchResult holds the messages found by a search
+type ArchiveSearchResult struct {
+	Entries         []*ArchivedLogEntry `json:"entries"`
+	Truncated       bool                `json:"truncated"` // more messages match than returned
+	SegmentsScanned int                 `json:"segments_scanned"`
+	SegmentsSkipped int                 `json:"segments_skipped"` // excluded by their index
+}
+
+// archiveSegment is the segment currently written
+type archiveSegment struct {
+	path    string
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	index   *archiveIndex
+	opened  time.Time
+}
+
+// countingWriter counts the compressed bytes written to a segment
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// RawArchive stores raw log messages in compressed, time-partitioned segment files:
+//
+//	<dir>/<YYYY-MM-DD>/seg-<unixnano>.jsonl.gz   gzip compressed JSON lines
+//	<dir>/<YYYY-MM-DD>/seg-<unixnano>.idx.json   time range, hosts, levels and loggers of the segment
+//
+// Segments are partitioned by arrival time and sealed after the segment duration (or 64MB).
+// Late messages are found through the time range of the index.
+type RawArchive struct {
+	dir             string
+	segmentDuration time.Duration
+	retentionDays   int
+	current         *archiveSegment
+	indexes         map[string]*archiveIndex // sealed segment path -> index
+	written         int64                    // messages archived since start
+	errors          int64                    // failed writes
+	mu              sync.Mutex
+}
+
+// OpenRawArchive opens the archive directory. Segments left open by a crash are indexed.
+func OpenRawArchive(dir string, segmentDuration time.Duration, retentionDays int) (*RawArchive, error) {
+	if segmentDuration <= 0 {
+		return nil, fmt.Errorf("invalid archive segment duration %v", segmentDuration)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	a := &RawArchive{
+		dir:             dir,
+		segmentDuration: segmentDuration,
+		retentionDays:   retentionDays,
+		indexes:         make(map[string]*archiveIndex),
+	}
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*", "seg-*"+archiveSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		idx, err := readArchiveIndex(segment)
+		if err != nil {
+			// No index: the process stopped while the segment was written
+			if idx, err = indexArchiveSegment(segment); err != nil {
+				log.Printf("Error indexing archive segment %s: %v\n", segment, err)
+				continue
+			}
+			if err := writeArchiveIndex(segment, idx); err != nil {
+				log.Printf("Error writing archive index %s: %v\n", segment, err)
+			}
+		}
+		a.indexes[segment] = idx
+	}
+
+	return a, nil
+}
+
+// Append archives a message
+func (a *RawArchive) Append(entry *RawLogEntry) {
+	archived := &ArchivedLogEntry{
+		Timestamp:  entry.Timestamp,
+		Host:       entry.Host,
+		Level:      entry.Level,
+		Logger:     entry.Logger,
+		Message:    entry.Message,
+		StackTrace: entry.StackTrace,
+		Thread:     entry.ThreadName,
+		NDC:        entry.NDC,
+		MDC:        entry.MDC,
+		Labels:     entry.Labels,
+		PatternID:  entry.PatternID,
+	}
+	line, err := json.Marshal(archived)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.write(line, archived); err != nil {
+		a.errors++
+		if a.errors == 1 || a.errors%1000 == 0 {
+			log.Printf("Error writing raw archive %s (%d errors): %v\n", a.dir, a.errors, err)
+		}
+		return
+	}
+	a.written++
+}
+
+// write adds a line to the current segment, rotating it if needed. Callers hold a.mu.
+func (a *RawArchive) write(line []byte, entry *ArchivedLogEntry) error {
+	now := time.Now()
+	if a.current != nil && (now.Sub(a.current.opened) >= a.segmentDuration || a.current.counter.n >= archiveSegmentSize) {
+		a.seal()
+	}
+	if a.current == nil {
+		if err := a.openSegment(now); err != nil {
+			return err
+		}
+	}
+
+	if _, err := a.current.buf.Write(line); err != nil {
+		return err
+	}
+	a.current.index.add(entry)
+	return nil
+}
+
+// openSegment starts a new segment in the day partition of the arrival time. Callers hold a.mu.
+func (a *RawArchive) openSegment(now time.Time) error {
+	partition := filepath.Join(a.dir, now.Format("2006-01-02"))
+	if err := os.MkdirAll(partition, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(partition, fmt.Sprintf("seg-%d%s", now.UnixNano(), archiveSegmentExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	counter := &countingWriter{w: file}
+	gz := gzip.NewWriter(counter)
+	a.current = &archiveSegment{
+		path:    path,
+		file:    file,
+		counter: counter,
+		gz:      gz,
+		buf:     bufio.NewWriter(gz),
+		index:   newArchiveIndex(),
+		opened:  now,
+	}
+	return nil
+}
+
+// seal completes the current segment and writes its index. Callers hold a.mu.
+func (a *RawArchive) seal() {
+	segment := a.current
+	if segment == nil {
+		return
+	}
+	a.current = nil
+
+	segment.buf.Flush()
+	segment.gz.Close()
+	segment.file.Sync()
+	segment.file.Close()
+
+	if segment.index.Count == 0 {
+		os.Remove(segment.path)
+		return
+	}
+	if err := writeArchiveIndex(segment.path, segment.index); err != nil {
+		log.Printf("Error writing archive index %s: %v\n", segment.path, err)
+	}
+	a.indexes[segment.path] = segment.index
+}
+
+// flushCurrent makes the buffered messages of the current segment readable. Callers hold a.mu.
+func (a *RawArchive) flushCurrent() {
+	if a.current == nil {
+		return
+	}
+	a.current.buf.Flush()
+	a.current.gz.Flush()
+}
+
+// Run flushes the current segment every few seconds, seals it after the segment duration and
+// removes day partitions past the retention
+func (a *RawArchive) Run() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	lastCleanup := time.Time{}
+	for range ticker.C {
+		a.mu.Lock()
+		if a.current != nil && time.Since(a.current.opened) >= a.segmentDuration {
+			a.seal()
+		} else {
+			a.flushCurrent()
+		}
+		a.mu.Unlock()
+
+		if time.Since(lastCleanup) >= time.Hour {
+			a.Cleanup()
+			lastCleanup = time.Now()
+		}
+	}
+}
+
+// Cleanup removes the day partitions before the retention cutoff day
+func (a *RawArchive) Cleanup() {
+	if a.retentionDays <= 0 {
+		return
+	}
+	cutoffDay := time.Now().AddDate(0, 0, -a.retentionDays).Format("2006-01-02")
+
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		log.Printf("Error reading raw archive %s: %v\n", a.dir, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() >= cutoffDay {
+			continue
+		}
+		partition := filepath.Join(a.dir, entry.Name())
+		if a.current != nil && filepath.Dir(a.current.path) == partition {
+			continue
+		}
+		if err := os.RemoveAll(partition); err != nil {
+			log.Printf("Error removing archive partition %s: %v\n", partition, err)
+			continue
+		}
+		for path := range a.indexes {
+			if filepath.Dir(path) == partition {
+				delete(a.indexes, path)
+			}
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("Raw archive cleanup: deleted %d day partitions older than %d days\n", removed, a.retentionDays)
+	}
+}
+
+// Search returns the archived messages matching the query, earliest first
+func (a *RawArchive) Search(q ArchiveQuery) (*ArchiveSearchResult, error) {
+	loggerRegex, err := compileLoggerRegex(q.LoggerRegex)
+	if err != nil {
+		return nil, err
+	}
+	if q.MaxResults <= 0 || q.MaxResults > archiveMaxResults {
+		q.MaxResults = archiveMaxResults
+	}
+	text := strings.ToLower(q.Text)
+
+	// Select segments by index, the current one is flushed so it can be read
+	type candidate struct {
+		path  string
+		index *archiveIndex
+	}
+	result := &ArchiveSearchResult{Entries: []*ArchivedLogEntry{}}
+	var candidates []candidate
+
+	a.mu.Lock()
+	a.flushCurrent()
+	for path, idx := range a.indexes {
+		if q.matchesIndex(idx, loggerRegex) {
+			candidates = append(candidates, candidate{path, idx})
+		} else {
+			result.SegmentsSkipped++
+		}
+	}
+	if a.current != nil {
+		if q.matchesIndex(a.current.index, loggerRegex) {
+			indexCopy := *a.current.index
+			candidates = append(candidates, candidate{a.current.path, &indexCopy})
+		} else if a.current.index.Count > 0 {
+			result.SegmentsSkipped++
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].index.MinTS.Before(candidates[j].index.MinTS)
+	})
+
+	for _, c := range candidates {
+		// The earliest matches are complete once the remaining segments start after the last kept message
+		if len(result.Entries) >= q.MaxResults && c.index.MinTS.After(result.Entries[len(result.Entries)-1].Timestamp) {
+			result.Truncated = true
+			break
+		}
+
+		result.SegmentsScanned++
+		err := readArchiveSegment(c.path, func(entry *ArchivedLogEntry) {
+			if q.matches(entry, loggerRegex, text) {
+				result.Entries = append(result.Entries, entry)
+			}
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed by retention meanwhile
+				continue
+			}
+			return nil, err
+		}
+
+		sort.SliceStable(result.Entries, func(i, j int) bool {
+			return result.Entries[i].Timestamp.Before(result.Entries[j].Timestamp)
+		})
+		if len(result.Entries) > q.MaxResults {
+			result.Entries = result.Entries[:q.MaxResults]
+			result.Truncated = true
+		}
+	}
+
+	return result, nil
+}
+
+// Close seals the current segment
+func (a *RawArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seal()
+	return nil
+}
+
+// Stats returns archive statistics
+func (a *RawArchive) Stats() map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	messages := 0
+	for _, idx := range a.indexes {
+		messages += idx.Count
+	}
+	segments := len(a.indexes)
+	if a.current != nil {
+		messages += a.current.index.Count
+		segments++
+	}
+
+	return map[string]interface{}{
+		"dir":              a.dir,
+		"segment_duration": a.segmentDuration.String(),
+		"retention_days":   a.retentionDays,
+		"segments":         segments,
+		"messages":         messages,
+		"written":          a.written,
+		"errors":           a.errors,
+	}
+}
+
+// readArchiveSegment calls fn for every message of a segment. A segment that is still written or was cut off
+// by a crash ends with an incomplete gzip stream, the messages before are returned.
+func readArchiveSegment(path string, fn func(entry *ArchivedLogEntry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := &ArchivedLogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			continue
+		}
+		fn(entry)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return nil
+}
+
+// indexArchiveSegment builds the index of a segment by reading it
+func indexArchiveSegment(path string) (*archiveIndex, error) {
+	idx := newArchiveIndex()
+	err := readArchiveSegment(path, idx.add)
+	return idx, err
+}
+
+// archiveIndexPath returns the index file of a segment
+func archiveIndexPath(segment string) string {
+	return strings.TrimSuffix(segment, archiveSegmentExt) + archiveIndexExt
+}
+
+func readArchiveIndex(segment string) (*archiveIndex, error) {
+	data, err := os.ReadFile(archiveIndexPath(segment))
+	if err != nil {
+		return nil, err
+	}
+	idx := newArchiveIndex()
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func writeArchiveIndex(segment string, idx *archiveIndex) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmpPath := archiveIndexPath(segment) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, archiveIndexPath(segment))
+}
+
+// EnableArchive archives every counted message in the raw archive
+func (s *LogStatStore) EnableArchive(dir string, segmentDuration time.Duration, retentionDays int) error {
+	archive, err := OpenRawArchive(dir, segmentDuration, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.archive = archive
+	return nil
+}
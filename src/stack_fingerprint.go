@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// maxSampleTraceLength limits the size of the sample stack trace stored per fingerprint
+const maxSampleTraceLength = 16 * 1024
+
+// defaultFrameworkPackages are treated as non-application frames if no application packages are configured
+var defaultFrameworkPackages = []string{
+	"java.", "javax.", "jakarta.", "jdk.", "sun.", "com.sun.",
+	"org.jboss.", "org.wildfly.", "io.undertow.", "org.xnio.",
+	"org.hibernate.", "org.springframework.", "org.apache.", "org.glassfish.",
+	"org.eclipse.", "io.netty.", "io.smallrye.", "org.jboss.resteasy.",
+	"org.infinispan.", "com.arjuna.", "org.postgresql.", "oracle.", "com.mysql.",
+	"kotlin.", "scala.", "groovy.",
+}
+
+// Proxy and generated class name parts that differ between deployments or JVM runs
+var proxySuffixes = []struct {
+	regex       *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\$\$(EnhancerBy|FastClassBy)\w*?\$\$[0-9a-fA-F]+`), ""},
+	{regexp.MustCompile(`\$\$Lambda(\$\d+)?(/(0x)?[0-9a-fA-F]+)?`), "$$$$Lambda"},
+	{regexp.MustCompile(`\$Proxy\$_\$\$_Weld\w+`), ""},
+	{regexp.MustCompile(`\$\$_Weld\w+`), ""},
+	{regexp.MustCompile(`\$\$_javassist_\d+`), ""},
+	{regexp.MustCompile(`\$HibernateProxy\$\w+`), ""},
+	{regexp.MustCompile(`\$Proxy\d+`), "$$Proxy"},
+	{regexp.MustCompile(`(GeneratedMethodAccessor|GeneratedConstructorAccessor|GeneratedSerializationConstructorAccessor)\d+`), "$1"},
+}
+
+// StackFingerprinter computes normalized fingerprints of stack traces: exception class plus the
+// top application frames, ignoring line numbers and proxy class suffixes
+type StackFingerprinter struct {
+	appPackages []string // frames of these packages are application frames (empty = all non-framework frames)
+	topFrames   int      // number of application frames included in the fingerprint
+}
+
+// StackFingerprint is the normalized identity of a stack trace
+type StackFingerprint struct {
+	Hash           string   `json:"fingerprint"`
+	ExceptionClass string   `json:"exception_class"`
+	Frames         []string `json:"top_frames"`
+}
+
+// NewStackFingerprinter creates a fingerprinter using the top N application frames
+func NewStackFingerprinter(appPackages []string, topFrames int) *StackFingerprinter {
+	if topFrames <= 0 {
+		topFrames = 5
+	}
+	return &StackFingerprinter{
+		appPackages: appPackages,
+		topFrames:   topFrames,
+	}
+}
+
+// Fingerprint computes the fingerprint of a stack trace. Only the outermost exception
+// (up to the first "Caused by:") is used.
+func (f *StackFingerprinter) Fingerprint(stackTrace string) *StackFingerprint {
+	fp := &StackFingerprint{}
+	var allFrames []string
+
+	for _, line := range strings.Split(stackTrace, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "at ") {
+			frame := normalizeFrame(trimmed)
+			allFrames = append(allFrames, frame)
+			if len(fp.Frames) < f.topFrames && f.isAppFrame(frame) {
+				fp.Frames = append(fp.Frames, frame)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "Caused by:") {
+			break
+		}
+
+		// First non-frame line is the exception header, e.g. "java.lang.IllegalStateException: message"
+		if fp.ExceptionClass == "" && len(allFrames) == 0 {
+			fp.ExceptionClass = exceptionClassName(trimmed)
+		}
+	}
+
+	if fp.ExceptionClass == "" {
+		fp.ExceptionClass = "Unknown"
+	}
+
+	// Without application frames fall back to the top frames
+	if len(fp.Frames) == 0 {
+		fp.Frames = allFrames
+		if len(fp.Frames) > f.topFrames {
+			fp.Frames = fp.Frames[:f.topFrames]
+		}
+	}
+
+	hash := sha256.Sum256([]byte(fp.ExceptionClass + "\n" + strings.Join(fp.Frames, "\n")))
+	fp.Hash = hex.EncodeToString(hash[:8])
+
+	return fp
+}
+
+// isAppFrame reports whether a normalized frame belongs to the application
+func (f *StackFingerprinter) isAppFrame(frame string) bool {
+	if len(f.appPackages) > 0 {
+		for _, pkg := range f.appPackages {
+			if strings.HasPrefix(frame, pkg) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pkg := range defaultFrameworkPackages {
+		if strings.HasPrefix(frame, pkg) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeFrame reduces a frame line to "class.method" without source location and proxy suffixes,
+// e.g. "at com.example.Service$$EnhancerBySpringCGLIB$$1a2b.run(Service.java:42)" -> "com.example.Service.run"
+func normalizeFrame(line string) string {
+	frame := strings.TrimSpace(strings.TrimPrefix(line, "at "))
+
+	// Drop source location "(File.java:123)"
+	if idx := strings.Index(frame, "("); idx > 0 {
+		frame = frame[:idx]
+	}
+
+	// Proxy suffixes first, lambda names contain a "/"
+	for _, suffix := range proxySuffixes {
+		frame = suffix.regex.ReplaceAllString(frame, suffix.replacement)
+	}
+
+	// Drop module prefix "java.base/" or "deployment.app.war//"
+	if idx := strings.LastIndex(frame, "/"); idx >= 0 {
+		frame = frame[idx+1:]
+	}
+	return frame
+}
+
+// exceptionClassName extracts the exception class from a header line such as
+// "org.example.MyException: something failed"
+func exceptionClassName(line string) string {
+	className, _, _ := strings.Cut(line, ":")
+	className = strings.TrimSpace(className)
+	if strings.ContainsAny(className, " \t") {
+		// Not a class name (e.g. a message line), keep the first token
+		className = strings.Fields(className)[0]
+	}
+	for _, suffix := range proxySuffixes {
+		className = suffix.regex.ReplaceAllString(className, suffix.replacement)
+	}
+	return className
+}
+
+// truncateSampleTrace limits a sample stack trace to maxSampleTraceLength bytes
+func truncateSampleTrace(stackTrace string) string {
+	if len(stackTrace) <= maxSampleTraceLength {
+		return stackTrace
+	}
+	return stackTrace[:maxSampleTraceLength] + "\n..."
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// StackTraceInfo describes a stack trace fingerprint seen since the last flush
+type StackTraceInfo struct {
+	Fingerprint    string
+	ExceptionClass string
+	Frames         []string
+	Logger         string
+	FirstSeenTS    string
+	LastSeenTS     string
+	Count          int
+	SampleTrace    string
+}
+
+// ExceptionSummary represents an exception fingerprint with its occurrences in a query range
+type ExceptionSummary struct {
+	Fingerprint    string   `json:"fingerprint"`
+	ExceptionClass string   `json:"exception_class"`
+	TopFrames      []string `json:"top_frames"`
+	Logger         string   `json:"logger"`
+	Count          int      `json:"count"`       // occurrences in the query range
+	Hosts          []string `json:"hosts"`       // hosts affected in the query range
+	TotalCount     int64    `json:"total_count"` // occurrences since first seen
+	FirstSeenTS    string   `json:"first_seen_ts"`
+	LastSeenTS     string   `json:"last_seen_ts"`
+	SampleTrace    string   `json:"sample_trace,omitempty"`
+}
+
+// recordException fingerprints the stack trace of an entry and counts it in the bucket
+func (s *LogStatStore) recordException(entry *RawLogEntry, bucketTS string) {
+	fp := s.fingerprinter.Fingerprint(entry.StackTrace)
+	entry.StackFingerprint = fp.Hash
+
+	seenTS := entry.Timestamp.Local().Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Per bucket counts
+	key := fp.Hash + ":" + entry.Host + ":" + entry.Logger + ":" + entry.Level + ":" + bucketTS
+	if stat, exists := s.exceptionEntries[key]; exists {
+		stat.N++
+	} else {
+		s.exceptionEntries[key] = &ExceptionStat{
+			Fingerprint: fp.Hash,
+			HostName:    entry.Host,
+			Logger:      entry.Logger,
+			Level:       entry.Level,
+			BucketTS:    bucketTS,
+			N:           1,
+		}
+	}
+
+	// Fingerprint catalog
+	if info, exists := s.stackTraces[fp.Hash]; exists {
+		info.Count++
+		if seenTS < info.FirstSeenTS {
+			info.FirstSeenTS = seenTS
+		}
+		if seenTS > info.LastSeenTS {
+			info.LastSeenTS = seenTS
+		}
+	} else {
+		s.stackTraces[fp.Hash] = &StackTraceInfo{
+			Fingerprint:    fp.Hash,
+			ExceptionClass: fp.ExceptionClass,
+			Frames:         fp.Frames,
+			Logger:         entry.Logger,
+			FirstSeenTS:    seenTS,
+			LastSeenTS:     seenTS,
+			Count:          1,
+			SampleTrace:    truncateSampleTrace(entry.StackTrace),
+		}
+	}
+}
+
+// flushExceptions writes the exception stats and fingerprints of a flush batch within the flush transaction
+func (s *LogStatStore) flushExceptions(tx *sql.Tx, batch *flushBatch) error {
+	if len(batch.stackTraces) == 0 {
+		return nil
+	}
+
+	statSQL := `
+	INSERT INTO stack_trace_stats (fingerprint, hostname, logger, level, bucket_ts, n)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(fingerprint, hostname, logger, level, bucket_ts)
+	DO UPDATE SET n = stack_trace_stats.n + excluded.n;
+	`
+	statStmt, err := tx.Prepare(statSQL)
+	if err != nil {
+		return err
+	}
+	defer statStmt.Close()
+
+	// Hosts are tracked apart from the exception stats, which are pruned by retention
+	hostStmt, err := tx.Prepare("INSERT OR IGNORE INTO stack_trace_hosts (fingerprint, hostname) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer hostStmt.Close()
+
+	for _, stat := range batch.exceptionEntries {
+		if _, err := statStmt.Exec(stat.Fingerprint, stat.HostName, stat.Logger, stat.Level, stat.BucketTS, stat.N); err != nil {
+			return fmt.Errorf("upserting exception stat: %w", err)
+		}
+		if _, err := hostStmt.Exec(stat.Fingerprint, stat.HostName); err != nil {
+			return fmt.Errorf("recording exception host: %w", err)
+		}
+	}
+
+	// The first sample trace is kept, counts are added up
+	traceSQL := `
+	INSERT INTO stack_traces (fingerprint, exception_class, top_frames, logger, first_seen_ts, last_seen_ts, total_count, host_count, sample_trace)
+	VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)
+	ON CONFLICT(fingerprint)
+	DO UPDATE SET
+		total_count = stack_traces.total_count + excluded.total_count,
+		first_seen_ts = MIN(stack_traces.first_seen_ts, excluded.first_seen_ts),
+		last_seen_ts = MAX(stack_traces.last_seen_ts, excluded.last_seen_ts);
+	`
+	traceStmt, err := tx.Prepare(traceSQL)
+	if err != nil {
+		return err
+	}
+	defer traceStmt.Close()
+
+	hostCountStmt, err := tx.Prepare("UPDATE stack_traces SET host_count = MAX(host_count, (SELECT COUNT(*) FROM stack_trace_hosts WHERE fingerprint = ?)) WHERE fingerprint = ?")
+	if err != nil {
+		return err
+	}
+	defer hostCountStmt.Close()
+
+	for _, info := range batch.stackTraces {
+		if _, err := traceStmt.Exec(info.Fingerprint, info.ExceptionClass, strings.Join(info.Frames, "\n"), info.Logger, info.FirstSeenTS, info.LastSeenTS, info.Count, info.SampleTrace); err != nil {
+			return fmt.Errorf("upserting stack trace: %w", err)
+		}
+		if _, err := hostCountStmt.Exec(info.Fingerprint, info.Fingerprint); err != nil {
+			return fmt.Errorf("updating stack trace host count: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// QueryExceptions returns the exception fingerprints occurring in the query range, most frequent first
+func (s *LogStatStore) QueryExceptions(filter QueryFilter) ([]*ExceptionSummary, error) {
+	loggerRegex, err := compileLoggerRegex(filter.LoggerRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	summaryMap := make(map[string]*ExceptionSummary)
+	hosts := make(map[string]map[string]bool)
+
+	getSummary := func(fingerprint string) *ExceptionSummary {
+		summary, exists := summaryMap[fingerprint]
+		if !exists {
+			summary = &ExceptionSummary{Fingerprint: fingerprint}
+			summaryMap[fingerprint] = summary
+			hosts[fingerprint] = make(map[string]bool)
+		}
+		return summary
+	}
+
+	// Database: counts in range joined with the fingerprint catalog
+	if filter.IncludeDB {
+		if err := s.queryExceptionsFromDB(filter, func(summary *ExceptionSummary, hostName string) {
+			existing := getSummary(summary.Fingerprint)
+			existing.Count += summary.Count
+			hosts[summary.Fingerprint][hostName] = true
+			if existing.ExceptionClass == "" {
+				existing.ExceptionClass = summary.ExceptionClass
+				existing.TopFrames = summary.TopFrames
+				existing.Logger = summary.Logger
+				existing.TotalCount = summary.TotalCount
+				existing.FirstSeenTS = summary.FirstSeenTS
+				existing.LastSeenTS = summary.LastSeenTS
+				existing.SampleTrace = summary.SampleTrace
+			}
+		}); err != nil {
+			log.Printf("Error querying exceptions from database: %v\n", err)
+		}
+	}
+
+	// Memory: counts since the last flush
+	s.mu.RLock()
+	if filter.IncludeMemory {
+		for _, entries := range s.pendingExceptionEntries() {
+			for _, stat := range entries {
+				if filter.Level != "" && stat.Level != filter.Level {
+					continue
+				}
+				if loggerRegex != nil && !loggerRegex.MatchString(stat.Logger) {
+					continue
+				}
+				if (!filter.StartTime.IsZero() || !filter.EndTime.IsZero()) && !bucketInRange(stat.BucketTS, filter) {
+					continue
+				}
+				getSummary(stat.Fingerprint).Count += stat.N
+				hosts[stat.Fingerprint][stat.HostName] = true
+			}
+		}
+	}
+
+	// Add not yet flushed occurrences to the catalog values
+	for _, stackTraces := range s.pendingStackTraces() {
+		for fingerprint, summary := range summaryMap {
+			info, exists := stackTraces[fingerprint]
+			if !exists {
+				continue
+			}
+			summary.TotalCount += int64(info.Count)
+			if summary.ExceptionClass == "" {
+				summary.ExceptionClass = info.ExceptionClass
+				summary.TopFrames = info.Frames
+				summary.Logger = info.Logger
+				summary.SampleTrace = info.SampleTrace
+			}
+			if summary.FirstSeenTS == "" || info.FirstSeenTS < summary.FirstSeenTS {
+				summary.FirstSeenTS = info.FirstSeenTS
+			}
+			if info.LastSeenTS > summary.LastSeenTS {
+				summary.LastSeenTS = info.LastSeenTS
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	results := make([]*ExceptionSummary, 0, len(summaryMap))
+	for fingerprint, summary := range summaryMap {
+		summary.Hosts = make([]string, 0, len(hosts[fingerprint]))
+		for host := range hosts[fingerprint] {
+			summary.Hosts = append(summary.Hosts, host)
+		}
+		sort.Strings(summary.Hosts)
+		results = append(results, summary)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
+		}
+		return results[i].Fingerprint < results[j].Fingerprint
+	})
+
+	if filter.MaxResults > 0 && len(results) > filter.MaxResults {
+		results = results[:filter.MaxResults]
+	}
+
+	return results, nil
+}
+
+// queryExceptionsFromDB aggregates exception stats per fingerprint and host using SQL GROUP BY
+func (s *LogStatStore) queryExceptionsFromDB(filter QueryFilter, add func(summary *ExceptionSummary, hostName string)) error {
+	query := `
+		SELECT
+			es.fingerprint,
+			es.hostname,
+			es.logger,
+			SUM(es.n),
+			COALESCE(st.exception_class, ''),
+			COALESCE(st.top_frames, ''),
+			COALESCE(st.logger, ''),
+			COALESCE(st.total_count, 0),
+			COALESCE(st.first_seen_ts, ''),
+			COALESCE(st.last_seen_ts, ''),
+			COALESCE(st.sample_trace, '')
+		FROM stack_trace_stats es
+		LEFT JOIN stack_traces st ON st.fingerprint = es.fingerprint
+		WHERE 1=1
+	`
+	var args []interface{}
+
+	if filter.Level != "" {
+		query += " AND es.level = ?"
+		args = append(args, filter.Level)
+	}
+
+	if filter.LoggerRegex != "" {
+		condition, regexArgs := regexCondition("es.logger", filter.LoggerRegex)
+		query += condition
+		args = append(args, regexArgs...)
+	}
+
+	if !filter.StartTime.IsZero() {
+		query += " AND es.bucket_ts >= ?"
+		args = append(args, filter.StartTime.Format(time.RFC3339))
+	}
+
+	if !filter.EndTime.IsZero() {
+		query += " AND es.bucket_ts <= ?"
+		args = append(args, filter.EndTime.Format(time.RFC3339))
+	}
+
+	query += " GROUP BY es.fingerprint, es.hostname, es.logger"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		summary := &ExceptionSummary{}
+		var hostName, statLogger, topFrames string
+		if err := rows.Scan(&summary.Fingerprint, &hostName, &statLogger, &summary.Count, &summary.ExceptionClass, &topFrames, &summary.Logger,
+			&summary.TotalCount, &summary.FirstSeenTS, &summary.LastSeenTS, &summary.SampleTrace); err != nil {
+			log.Printf("Error scanning exception row: %v\n", err)
+			continue
+		}
+
+		if topFrames != "" {
+			summary.TopFrames = strings.Split(topFrames, "\n")
+		}
+		add(summary, hostName)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Journal fsync policies
+const (
+	JournalSyncAlways   = "always"   // fsync after every record (safe against power loss, slowest)
+	JournalSyncInterval = "interval" // fsync periodically (records reach the OS immediately)
+	JournalSyncNone     = "none"     // never fsync, the OS writes back (safe against process crashes only)
+)
+
+// JournalRecord is one AddOrUpdate delta: a single entry counted in its buckets
+type JournalRecord struct {
+	EventTS string `json:"t"` // event time after late arrival handling (RFC3339Nano)
+	Host    string `json:"h"`
+	Level   string `json:"l"`
+	Logger  string `json:"g"`
+}
+
+// StatJournal is an append-only journal of the in-memory bucket deltas since the last flush.
+// It is replayed on startup. Each flush seals the journal file as a segment, which is removed
+// once the flush succeeded.
+type StatJournal struct {
+	path       string
+	file       *os.File
+	syncPolicy string
+	records    int64 // records in the current journal file
+	dirty      bool  // records written since the last fsync
+	errors     int64 // failed writes
+	mu         sync.Mutex
+}
+
+// OpenStatJournal opens (or creates) the journal file for appending
+func OpenStatJournal(path, syncPolicy string) (*StatJournal, error) {
+	switch syncPolicy {
+	case JournalSyncAlways, JournalSyncInterval, JournalSyncNone:
+	default:
+		return nil, fmt.Errorf("invalid journal sync policy %q (allowed: %s, %s, %s)", syncPolicy, JournalSyncAlways, JournalSyncInterval, JournalSyncNone)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatJournal{
+		path:       path,
+		file:       file,
+		syncPolicy: syncPolicy,
+	}, nil
+}
+
+// Replay reads all complete records of the sealed segments and the journal file. A torn last line
+// (crash during a write) is skipped. Returns the number of records and the sealed segments.
+func (j *StatJournal) Replay(apply func(record JournalRecord, eventTime time.Time)) (int, []string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Segments of flushes that did not complete, oldest first
+	segments, err := filepath.Glob(j.path + ".flushing-*")
+	if err != nil {
+		return 0, nil, err
+	}
+	sort.Strings(segments)
+
+	replayed, skipped := 0, 0
+	for _, segment := range segments {
+		file, err := os.Open(segment)
+		if err != nil {
+			return replayed, segments, err
+		}
+		n, bad, err := replayRecords(file, apply)
+		file.Close()
+		replayed += n
+		skipped += bad
+		if err != nil {
+			return replayed, segments, err
+		}
+	}
+
+	if _, err := j.file.Seek(0, 0); err != nil {
+		return replayed, segments, err
+	}
+	n, bad, err := replayRecords(j.file, apply)
+	replayed += n
+	skipped += bad
+	if err != nil {
+		return replayed, segments, err
+	}
+	j.records = int64(n)
+
+	if skipped > 0 {
+		log.Printf("Warning: skipped %d unreadable journal records\n", skipped)
+	}
+
+	// Terminate a torn last line so the next record starts on a new line
+	if info, err := j.file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := j.file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			j.file.Write([]byte{'\n'})
+		}
+	}
+
+	return replayed, segments, nil
+}
+
+// replayRecords applies the records of one journal file, returning the number of applied and unreadable records
+func replayRecords(file *os.File, apply func(record JournalRecord, eventTime time.Time)) (int, int, error) {
+	replayed, skipped := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			skipped++
+			continue
+		}
+		eventTime, err := time.Parse(time.RFC3339Nano, record.EventTS)
+		if err != nil {
+			skipped++
+			continue
+		}
+		apply(record, eventTime.Local())
+		replayed++
+	}
+	return replayed, skipped, scanner.Err()
+}
+
+// Append writes a record. Records are written to the OS immediately, fsync follows the sync policy.
+func (j *StatJournal) Append(record JournalRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(line); err != nil {
+		j.errors++
+		if j.errors == 1 || j.errors%1000 == 0 {
+			log.Printf("Error writing journal %s (%d errors): %v\n", j.path, j.errors, err)
+		}
+		return
+	}
+	j.records++
+
+	if j.syncPolicy == JournalSyncAlways {
+		j.file.Sync()
+	} else {
+		j.dirty = true
+	}
+}
+
+// Sync fsyncs records written since the last sync
+func (j *StatJournal) Sync() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.dirty {
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		log.Printf("Error syncing journal %s: %v\n", j.path, err)
+		return
+	}
+	j.dirty = false
+}
+
+// RunSync fsyncs the journal periodically (sync policy "interval")
+func (j *StatJournal) RunSync(interval time.Duration) {
+	if j.syncPolicy != JournalSyncInterval || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		j.Sync()
+	}
+}
+
+// Rotate seals the journal file as a segment and starts a new file, so records of entries ingested
+// during a flush are kept apart. Returns the segment path ("" if there were no records).
+func (j *StatJournal) Rotate() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.records == 0 {
+		return "", nil
+	}
+
+	j.file.Sync()
+	j.file.Close()
+
+	segment := fmt.Sprintf("%s.flushing-%d", j.path, time.Now().UnixNano())
+	renameErr := os.Rename(j.path, segment)
+
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	j.file = file
+	if renameErr != nil {
+		// Still the same file, its records are removed with a later segment
+		return "", renameErr
+	}
+
+	j.records = 0
+	j.dirty = false
+	return segment, nil
+}
+
+// RemoveSegments deletes sealed segments after their records were flushed to the database
+func (j *StatJournal) RemoveSegments(segments []string) {
+	for _, segment := range segments {
+		if err := os.Remove(segment); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing journal segment %s: %v\n", segment, err)
+		}
+	}
+}
+
+// Close syncs and closes the journal file
+func (j *StatJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.file.Sync()
+	return j.file.Close()
+}
+
+// Stats returns journal statistics
+func (j *StatJournal) Stats() map[string]interface{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stats := map[string]interface{}{
+		"path":        j.path,
+		"sync_policy": j.syncPolicy,
+		"records":     j.records,
+		"errors":      j.errors,
+	}
+	if info, err := j.file.Stat(); err == nil {
+		stats["size_bytes"] = info.Size()
+	}
+	return stats
+}
+
+// EnableJournal replays the journal of an unclean shutdown into the in-memory buckets
+// and journals all further deltas
+func (s *LogStatStore) EnableJournal(path, syncPolicy string) error {
+	journal, err := OpenStatJournal(path, syncPolicy)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Replayed deltas stay in the journal until the next flush
+	currentTime := time.Now()
+	n, segments, err := journal.Replay(func(record JournalRecord, eventTime time.Time) {
+		for _, res := range s.resolutions {
+			s.addToBucket(record.Host, record.Level, record.Logger, eventTime, currentTime, res.Size)
+		}
+	})
+	if err != nil {
+		journal.Close()
+		return fmt.Errorf("replaying journal %s: %w", path, err)
+	}
+	if n > 0 {
+		log.Printf("=== Replayed %d journal records into %d in-memory entries ===\n", n, len(s.entries))
+	}
+
+	s.journal = journal
+	s.journalSegments = segments
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// journalLine returns the journal line of a record
+func journalLine(t *testing.T, logger string) string {
+	t.Helper()
+	line, err := json.Marshal(JournalRecord{EventTS: "2026-10-16T10:00:00.5Z", Host: "app1", Level: "ERROR", Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(line) + "\n"
+}
+
+func TestStatJournalReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []string // contents of sealed segments, oldest first
+		journal  string   // content of the journal file
+		want     []string // loggers of the replayed records in order
+	}{
+		{
+			name: "empty journal",
+		},
+		{
+			name:    "complete records",
+			journal: journalLine(t, "a") + journalLine(t, "b"),
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "torn last line",
+			journal: journalLine(t, "a") + journalLine(t, "b") + `{"t":"2026-10-16T10:00:00.5Z","h":"app1","l":"ERR`,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "torn last line of a single record",
+			journal: `{"t":"2026-10-16T10:00`,
+		},
+		{
+			name:    "last line without newline",
+			journal: journalLine(t, "a") + journalLine(t, "b")[:len(journalLine(t, "b"))-1],
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "unreadable records are skipped",
+			journal: journalLine(t, "a") + "garbage\n" + `{"t":"yesterday","h":"app1","l":"ERROR","g":"x"}` + "\n" + journalLine(t, "b"),
+			want:    []string{"a", "b"},
+		},
+		{
+			name:     "segments before the journal",
+			segments: []string{journalLine(t, "a"), journalLine(t, "b") + `{"t":"20`},
+			journal:  journalLine(t, "c"),
+			want:     []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stats.journal")
+			for i, content := range tt.segments {
+				segment := fmt.Sprintf("%s.flushing-%d", path, time.Now().Add(-time.Hour).UnixNano()+int64(i))
+				if err := os.WriteFile(segment, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(path, []byte(tt.journal), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			journal, err := OpenStatJournal(path, JournalSyncNone)
+			if err != nil {
+				t.Fatalf("OpenStatJournal: %v", err)
+			}
+			defer journal.Close()
+
+			var got []string
+			n, segments, err := journal.Replay(func(record JournalRecord, eventTime time.Time) {
+				if !eventTime.Equal(time.Date(2026, 10, 16, 10, 0, 0, 5e8, time.UTC)) {
+					t.Errorf("event time %v of %q", eventTime, record.Logger)
+				}
+				got = append(got, record.Logger)
+			})
+			if err != nil {
+				t.Fatalf("Replay: %v", err)
+			}
+			if n != len(tt.want) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %d records %q, want %q", n, got, tt.want)
+			}
+			if len(segments) != len(tt.segments) {
+				t.Errorf("got segments %q, want %d", segments, len(tt.segments))
+			}
+
+			// A record appended after the replay starts on its own line
+			journal.Append(JournalRecord{EventTS: "2026-10-16T10:00:00.5Z", Host: "app1", Level: "ERROR", Logger: "new"})
+			if _, err := journal.Rotate(); err != nil {
+				t.Fatalf("Rotate: %v", err)
+			}
+			var again []string
+			if _, _, err := journal.Replay(func(record JournalRecord, eventTime time.Time) {
+				again = append(again, record.Logger)
+			}); err != nil {
+				t.Fatalf("Replay after append: %v", err)
+			}
+			if want := append(append([]string{}, tt.want...), "new"); !reflect.DeepEqual(again, want) {
+				t.Errorf("replayed %q after append, want %q", again, want)
+			}
+		})
+	}
+}
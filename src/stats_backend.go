@@ -0,0 +1,109 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"time"
+)
+
+// StatsBackend stores the flushed log stat buckets (all bucket sizes). Rollups, message patterns
+// and exception statistics are always kept in the SQLite database.
+type StatsBackend interface {
+	// Name returns the backend name ("sqlite", "columnar")
+	Name() string
+	// UpsertStats adds a batch of bucket counts (n is added, first_seen_ts keeps the minimum)
+	UpsertStats(stats []*LogStat) error
+	// QueryStats returns the buckets matching the query, newest first
+	QueryStats(q StatsQuery) ([]*LogStat, error)
+	// AggregateStats returns the matching buckets aggregated per host, bucket and level
+	AggregateStats(q StatsQuery) ([]*AggregatedStat, error)
+	// GroupStats returns the matching buckets aggregated by the given dimensions
+	GroupStats(q StatsQuery, g GroupBy) ([]*GroupedStat, error)
+	// LevelCounts returns the number of messages per level in buckets of the given size since a bucket timestamp
+	LevelCounts(bucketSize int, since string) (map[string]int64, error)
+	// Cleanup deletes buckets older than the retention of their resolution (unconfigured sizes: primary retention)
+	Cleanup(resolutions []BucketResolution) error
+	// Stats returns row counts and ranges of the buckets of the given size
+	Stats(bucketSize int) (*BackendStats, error)
+	// Close releases the resources of the backend
+	Close() error
+}
+
+// StatsQuery selects buckets of one bucket size
+type StatsQuery struct {
+	BucketSize  int    // bucket_size_s of the buckets (0 = any, rollup tables)
+	From        string // inclusive bucket_ts lower bound ("" = none)
+	Before      string // exclusive bucket_ts upper bound ("" = none)
+	Until       string // inclusive bucket_ts upper bound ("" = none)
+	Level       string // level (empty = all levels)
+	LoggerRegex string // regex matching logger names (empty = all loggers)
+	MaxResults  int    // maximum number of buckets (0 = unlimited)
+	Dimensions  DimensionFilter
+}
+
+// BackendStats holds row counts and ranges of one bucket size
+type BackendStats struct {
+	Rows            int
+	UniqueBuckets   int
+	UniqueLevels    int
+	UniqueLoggers   int
+	UniqueHosts     int
+	TotalMessages   int64
+	OldestBucket    string
+	NewestBucket    string
+	MessagesByLevel map[string]int64
+}
+
+// newStatsQuery builds the backend query of a statsSegment and a query filter
+func newStatsQuery(segment statsSegment, filter QueryFilter) StatsQuery {
+	q := StatsQuery{
+		BucketSize:  segment.bucketSize,
+		From:        segment.from,
+		Before:      segment.before,
+		Level:       filter.Level,
+		LoggerRegex: filter.LoggerRegex,
+		MaxResults:  filter.MaxResults,
+		Dimensions:  filter.Dimensions,
+	}
+	if !filter.StartTime.IsZero() {
+		start := filter.StartTime.Format(time.RFC3339)
+		if start > q.From {
+			q.From = start
+		}
+	}
+	if !filter.EndTime.IsZero() {
+		q.Until = filter.EndTime.Format(time.RFC3339)
+	}
+	return q
+}
+
+// matches reports whether a bucket matches the bounds and filters of the query (not the bucket size)
+func (q StatsQuery) matches(stat *LogStat, loggerRegex *regexp.Regexp, dimensions *dimensionMatcher) bool {
+	if q.From != "" && stat.BucketTS < q.From {
+		return false
+	}
+	if q.Before != "" && stat.BucketTS >= q.Before {
+		return false
+	}
+	if q.Until != "" && stat.BucketTS > q.Until {
+		return false
+	}
+	if q.Level != "" && stat.Level != q.Level {
+		return false
+	}
+	if loggerRegex != nil && !loggerRegex.MatchString(stat.Logger) {
+		return false
+	}
+	return dimensions.matches(stat.HostName, stat.Level, stat.Logger)
+}
+
+// sortStatsNewestFirst orders buckets by bucket_ts descending and applies the result limit
+func sortStatsNewestFirst(stats []*LogStat, maxResults int) []*LogStat {
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].BucketTS > stats[j].BucketTS
+	})
+	if maxResults > 0 && len(stats) > maxResults {
+		stats = stats[:maxResults]
+	}
+	return stats
+}
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Columnar segment files
+const (
+	columnarMagic            = "LSC1" // file header of a segment
+	columnarSegmentExt       = ".lsc"
+	columnarCompactThreshold = 16 // segments per day partition before they are compacted into one
+)
+
+// columnarBackend stores the buckets in immutable, compressed column files partitioned by bucket size and day:
+//
+//	<dir>/size=<bucket_size_s>/day=<YYYY-MM-DD>/seg-<seq>.lsc           segment of one flush
+//	<dir>/size=<bucket_size_s>/day=<YYYY-MM-DD>/seg-<seq>-<covered>.lsc compaction of the segments up to <covered>
+//	<dir>/commit-<seq>                                                  batch committed, not yet renamed everywhere
+//
+// Every flush writes one segment per partition holding its deltas. Reads merge the segments of the
+// partitions in range, cleanup removes whole day partitions.
+type columnarBackend struct {
+	dir     string
+	mu      sync.RWMutex
+	lastSeq int64 // highest segment sequence number on disk or handed out
+}
+
+// NewColumnarBackend creates (or opens) the columnar backend in the given directory
+func NewColumnarBackend(dir string) (StatsBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	b := &columnarBackend{dir: dir}
+	if err := b.recoverBatches(); err != nil {
+		return nil, err
+	}
+	if err := b.seedSeq(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *columnarBackend) Name() string {
+	return "columnar"
+}
+
+// UpsertStats writes the batch as one new segment per partition. The segments of a batch are
+// written to temporary files first, then a commit marker makes them visible in all partitions at once:
+// a crash before the marker discards the batch, a crash after it completes the batch on the next start.
+func (b *columnarBackend) UpsertStats(stats []*LogStat) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.recoverBatches(); err != nil {
+		return err
+	}
+
+	partitions := make(map[string][]*LogStat)
+	for _, stat := range stats {
+		if len(stat.BucketTS) < 10 {
+			continue
+		}
+		partition := b.partitionDir(stat.BucketSize_S, stat.BucketTS[:10])
+		partitions[partition] = append(partitions[partition], stat)
+	}
+
+	// Write all segments, then make them visible
+	seq := b.nextSeq()
+	segmentName := fmt.Sprintf("seg-%d%s", seq, columnarSegmentExt)
+	var written []string
+	for partition, partitionStats := range partitions {
+		if err := os.MkdirAll(partition, 0755); err != nil {
+			removeFiles(written)
+			return err
+		}
+		tmpPath := filepath.Join(partition, segmentName+".tmp")
+		if err := writeColumnarSegment(tmpPath, partitionStats); err != nil {
+			os.Remove(tmpPath)
+			removeFiles(written)
+			return err
+		}
+		written = append(written, tmpPath)
+	}
+
+	marker := b.commitMarker(seq)
+	if err := writeCommitMarker(marker); err != nil {
+		removeFiles(written)
+		return err
+	}
+
+	// The batch is committed, segments not renamed now are renamed by the next recovery
+	published := true
+	for _, tmpPath := range written {
+		if err := os.Rename(tmpPath, strings.TrimSuffix(tmpPath, ".tmp")); err != nil {
+			log.Printf("Error publishing columnar segment %s: %v\n", tmpPath, err)
+			published = false
+		}
+	}
+	if published {
+		os.Remove(marker)
+	}
+
+	for partition := range partitions {
+		if err := b.compactPartition(partition); err != nil {
+			log.Printf("Error compacting %s: %v\n", partition, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *columnarBackend) QueryStats(q StatsQuery) ([]*LogStat, error) {
+	loggerRegex, err := compileLoggerRegex(q.LoggerRegex)
+	if err != nil {
+		return nil, err
+	}
+	dimensions, err := q.Dimensions.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var stats []*LogStat
+	err = b.scan(q, func(stat *LogStat) {
+		if q.matches(stat, loggerRegex, dimensions) {
+			stats = append(stats, stat)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sortStatsNewestFirst(stats, q.MaxResults), nil
+}
+
+func (b *columnarBackend) AggregateStats(q StatsQuery) ([]*AggregatedStat, error) {
+	maxResults := q.MaxResults
+	q.MaxResults = 0
+	stats, err := b.QueryStats(q)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated := aggregateStats(stats)
+	sort.SliceStable(aggregated, func(i, j int) bool {
+		return aggregated[i].BucketTS > aggregated[j].BucketTS
+	})
+	if maxResults > 0 && len(aggregated) > maxResults {
+		aggregated = aggregated[:maxResults]
+	}
+	return aggregated, nil
+}
+
+func (b *columnarBackend) GroupStats(q StatsQuery, g GroupBy) ([]*GroupedStat, error) {
+	q.MaxResults = 0
+	stats, err := b.QueryStats(q)
+	if err != nil {
+		return nil, err
+	}
+	return groupStats(stats, g), nil
+}
+
+func (b *columnarBackend) LevelCounts(bucketSize int, since string) (map[string]int64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	err := b.scan(StatsQuery{BucketSize: bucketSize, From: since}, func(stat *LogStat) {
+		if stat.BucketTS >= since {
+			counts[stat.Level] += int64(stat.N)
+		}
+	})
+	return counts, err
+}
+
+// Cleanup removes the day partitions before the retention cutoff day of their bucket size
+func (b *columnarBackend) Cleanup(resolutions []BucketResolution) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	retention := make(map[int]int)
+	for _, res := range resolutions {
+		retention[int(res.Size.Seconds())] = res.RetentionDays
+	}
+
+	sizes, err := b.bucketSizes()
+	if err != nil {
+		return err
+	}
+
+	for _, size := range sizes {
+		// Bucket sizes no longer configured follow the primary retention
+		retentionDays, configured := retention[size]
+		if !configured {
+			retentionDays = resolutions[0].RetentionDays
+		}
+		cutoffDay := time.Now().AddDate(0, 0, -retentionDays).Format("2006-01-02")
+
+		days, err := b.days(size)
+		if err != nil {
+			return err
+		}
+
+		removed := 0
+		for _, day := range days {
+			if day >= cutoffDay {
+				continue
+			}
+			if err := os.RemoveAll(b.partitionDir(size, day)); err != nil {
+				log.Printf("    "+"Error cleaning up old data: %v\n", err)
+				return err
+			}
+			removed++
+		}
+		log.Printf("    "+"Cleanup: deleted %d %v day partitions older than %d days\n", removed, time.Duration(size)*time.Second, retentionDays)
+	}
+
+	return nil
+}
+
+func (b *columnarBackend) Stats(bucketSize int) (*BackendStats, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := &BackendStats{MessagesByLevel: make(map[string]int64)}
+	buckets := make(map[string]bool)
+	levels := make(map[string]bool)
+	loggers := make(map[string]bool)
+	hosts := make(map[string]bool)
+
+	err := b.scan(StatsQuery{BucketSize: bucketSize}, func(stat *LogStat) {
+		stats.Rows++
+		stats.TotalMessages += int64(stat.N)
+		stats.MessagesByLevel[stat.Level] += int64(stat.N)
+		buckets[stat.BucketTS] = true
+		levels[stat.Level] = true
+		loggers[stat.Logger] = true
+		hosts[stat.HostName] = true
+		if stats.OldestBucket == "" || stat.BucketTS < stats.OldestBucket {
+			stats.OldestBucket = stat.BucketTS
+		}
+		if stat.BucketTS > stats.NewestBucket {
+			stats.NewestBucket = stat.BucketTS
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.UniqueBuckets = len(buckets)
+	stats.UniqueLevels = len(levels)
+	stats.UniqueLoggers = len(loggers)
+	stats.UniqueHosts = len(hosts)
+	return stats, nil
+}
+
+// Close does nothing, segment files are only open while they are read or written
+func (b *columnarBackend) Close() error {
+	return nil
+}
+
+// nextSeq returns a segment sequence number (the write time) above all handed out before, so segments
+// written within the same clock tick do not replace each other. Callers hold b.mu.
+func (b *columnarBackend) nextSeq() int64 {
+	seq := time.Now().UnixNano()
+	if seq <= b.lastSeq {
+		seq = b.lastSeq + 1
+	}
+	b.lastSeq = seq
+	return seq
+}
+
+// seedSeq continues the sequence numbers after the highest one on disk, so new segments sort after
+// (and are never hidden by a compaction covering) the existing ones even if the clock went back.
+// Callers own b exclusively.
+func (b *columnarBackend) seedSeq() error {
+	segments, err := filepath.Glob(filepath.Join(b.dir, "size=*", "day=*", "seg-*"+columnarSegmentExt))
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		seq, covered := segmentSeq(segment)
+		if seq > b.lastSeq {
+			b.lastSeq = seq
+		}
+		if covered > b.lastSeq {
+			b.lastSeq = covered
+		}
+	}
+	return nil
+}
+
+// commitMarker returns the path of the commit marker of a batch
+func (b *columnarBackend) commitMarker(seq int64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("commit-%d", seq))
+}
+
+// writeCommitMarker creates a commit marker atomically
+func writeCommitMarker(path string) error {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+	}
+	return err
+}
+
+// recoverBatches completes the segments of committed batches and removes those of batches (and
+// compactions) interrupted before their commit. Callers hold b.mu or own b exclusively.
+func (b *columnarBackend) recoverBatches() error {
+	pending, err := filepath.Glob(filepath.Join(b.dir, "size=*", "day=*", "seg-*"+columnarSegmentExt+".tmp"))
+	if err != nil {
+		return err
+	}
+
+	for _, tmpPath := range pending {
+		seq, _ := segmentSeq(strings.TrimSuffix(tmpPath, ".tmp"))
+		if _, err := os.Stat(b.commitMarker(seq)); err != nil {
+			os.Remove(tmpPath)
+			continue
+		}
+		if err := os.Rename(tmpPath, strings.TrimSuffix(tmpPath, ".tmp")); err != nil {
+			return fmt.Errorf("completing columnar batch %d: %w", seq, err)
+		}
+	}
+
+	markers, err := filepath.Glob(filepath.Join(b.dir, "commit-*"))
+	if err != nil {
+		return err
+	}
+	removeFiles(markers)
+	return nil
+}
+
+// partitionDir returns the directory of a bucket size and day
+func (b *columnarBackend) partitionDir(bucketSize int, day string) string {
+	return filepath.Join(b.dir, fmt.Sprintf("size=%d", bucketSize), "day="+day)
+}
+
+// bucketSizes lists the bucket sizes with data
+func (b *columnarBackend) bucketSizes() ([]int, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "size=") {
+			continue
+		}
+		if size, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "size=")); err == nil {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes, nil
+}
+
+// days lists the day partitions of a bucket size, oldest first
+func (b *columnarBackend) days(bucketSize int) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(b.dir, fmt.Sprintf("size=%d", bucketSize)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "day=") {
+			days = append(days, strings.TrimPrefix(entry.Name(), "day="))
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// scan calls fn for every merged bucket of the partitions overlapping the bucket_ts bounds of the
+// query (all bucket sizes if the query has none). Callers hold b.mu.
+func (b *columnarBackend) scan(q StatsQuery, fn func(stat *LogStat)) error {
+	sizes := []int{q.BucketSize}
+	if q.BucketSize <= 0 {
+		var err error
+		if sizes, err = b.bucketSizes(); err != nil {
+			return err
+		}
+	}
+
+	// Day partitions are pruned by the date part of the bounds
+	upper := q.Before
+	if upper == "" || (q.Until != "" && q.Until < upper) {
+		upper = q.Until
+	}
+
+	for _, size := range sizes {
+		days, err := b.days(size)
+		if err != nil {
+			return err
+		}
+		for _, day := range days {
+			if len(q.From) >= 10 && day < q.From[:10] {
+				continue
+			}
+			if len(upper) >= 10 && day > upper[:10] {
+				continue
+			}
+
+			stats, err := readColumnarPartition(b.partitionDir(size, day))
+			if err != nil {
+				return err
+			}
+			for _, stat := range stats {
+				stat.BucketSize_S = size
+				fn(stat)
+			}
+		}
+	}
+	return nil
+}
+
+// compactPartition merges the segments of a partition into one once there are too many. Callers hold b.mu.
+func (b *columnarBackend) compactPartition(partition string) error {
+	segments, err := columnarSegments(partition)
+	if err != nil || len(segments) <= columnarCompactThreshold {
+		return err
+	}
+
+	stats, err := readColumnarPartition(partition)
+	if err != nil {
+		return err
+	}
+
+	// The compacted segment records the last merged segment, readers skip the merged ones as soon as
+	// it is visible, so a crash before they are removed does not count them twice
+	covered, _ := segmentSeq(segments[len(segments)-1])
+	seq := b.nextSeq()
+	if seq <= covered {
+		seq = covered + 1
+	}
+	compacted := filepath.Join(partition, fmt.Sprintf("seg-%d-%d%s", seq, covered, columnarSegmentExt))
+	if err := writeColumnarSegment(compacted+".tmp", stats); err != nil {
+		os.Remove(compacted + ".tmp")
+		return err
+	}
+	if err := os.Rename(compacted+".tmp", compacted); err != nil {
+		os.Remove(compacted + ".tmp")
+		return err
+	}
+
+	merged, err := filepath.Glob(filepath.Join(partition, "seg-*"+columnarSegmentExt))
+	if err != nil {
+		return err
+	}
+	for _, segment := range merged {
+		if segSeq, _ := segmentSeq(segment); segSeq <= covered {
+			os.Remove(segment)
+		}
+	}
+	return nil
+}
+
+// columnarSegments lists the segment files of a partition in write order, without the segments
+// merged into a compacted segment
+func columnarSegments(partition string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(partition, "seg-*"+columnarSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var maxCovered int64 = -1
+	for _, file := range files {
+		if _, covered := segmentSeq(file); covered > maxCovered {
+			maxCovered = covered
+		}
+	}
+
+	var segments []string
+	for _, file := range files {
+		if seq, _ := segmentSeq(file); seq > maxCovered {
+			segments = append(segments, file)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		seqI, _ := segmentSeq(segments[i])
+		seqJ, _ := segmentSeq(segments[j])
+		return seqI < seqJ
+	})
+	return segments, nil
+}
+
+// segmentSeq returns the write time encoded in a segment file name and, for a compacted segment, the
+// write time of the last segment merged into it (-1 otherwise)
+func segmentSeq(path string) (int64, int64) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "seg-"), columnarSegmentExt)
+	seqPart, coveredPart, compacted := strings.Cut(name, "-")
+	seq, _ := strconv.ParseInt(seqPart, 10, 64)
+	if !compacted {
+		return seq, -1
+	}
+	covered, err := strconv.ParseInt(coveredPart, 10, 64)
+	if err != nil {
+		return seq, -1
+	}
+	return seq, covered
+}
+
+// readColumnarPartition reads and merges all segments of a partition: n is summed, first_seen_ts
+// keeps the minimum and the duration of the latest segment wins (like the SQLite upsert)
+func readColumnarPartition(partition string) ([]*LogStat, error) {
+	segments, err := columnarSegments(partition)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]*LogStat)
+	var result []*LogStat
+	for _, segment := range segments {
+		stats, err := readColumnarSegment(segment)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", segment, err)
+		}
+		for _, stat := range stats {
+			key := stat.HostName + ":" + stat.Logger + ":" + stat.Level + ":" + stat.BucketTS
+			existing, exists := merged[key]
+			if !exists {
+				merged[key] = stat
+				result = append(result, stat)
+				continue
+			}
+			existing.N += stat.N
+			existing.BucketDuration_S = stat.BucketDuration_S
+			if existing.FirstSeenTS == "" || (stat.FirstSeenTS != "" && stat.FirstSeenTS < existing.FirstSeenTS) {
+				existing.FirstSeenTS = stat.FirstSeenTS
+			}
+		}
+	}
+	return result, nil
+}
+
+// writeColumnarSegment writes stats as a segment: the magic header followed by a gzip stream holding
+// the row count and one block per column. String columns are dictionary encoded.
+func writeColumnarSegment(path string, stats []*LogStat) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(columnarMagic); err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(file)
+	w := bufio.NewWriter(zw)
+
+	writeUvarint(w, uint64(len(stats)))
+	stringColumns := []func(stat *LogStat) string{
+		func(stat *LogStat) string { return stat.HostName },
+		func(stat *LogStat) string { return stat.BucketTS },
+		func(stat *LogStat) string { return stat.Level },
+		func(stat *LogStat) string { return stat.Logger },
+		func(stat *LogStat) string { return stat.FirstSeenTS },
+	}
+	for _, column := range stringColumns {
+		writeDictColumn(w, stats, column)
+	}
+	for _, stat := range stats {
+		writeUvarint(w, uint64(stat.N))
+	}
+	for _, stat := range stats {
+		writeUvarint(w, uint64(stat.BucketDuration_S))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// writeDictColumn writes a string column as dictionary followed by the dictionary index of every row
+func writeDictColumn(w *bufio.Writer, stats []*LogStat, value func(stat *LogStat) string) {
+	index := make(map[string]uint64)
+	var dict []string
+	for _, stat := range stats {
+		v := value(stat)
+		if _, exists := index[v]; !exists {
+			index[v] = uint64(len(dict))
+			dict = append(dict, v)
+		}
+	}
+
+	writeUvarint(w, uint64(len(dict)))
+	for _, v := range dict {
+		writeUvarint(w, uint64(len(v)))
+		w.WriteString(v)
+	}
+	for _, stat := range stats {
+		writeUvarint(w, index[value(stat)])
+	}
+}
+
+// readColumnarSegment reads all rows of a segment
+func readColumnarSegment(path string) ([]*LogStat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(columnarMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != columnarMagic {
+		return nil, fmt.Errorf("not a columnar segment")
+	}
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	r := bufio.NewReader(zr)
+
+	rows, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]*LogStat, rows)
+	for i := range stats {
+		stats[i] = &LogStat{}
+	}
+
+	stringColumns := []func(stat *LogStat, v string){
+		func(stat *LogStat, v string) { stat.HostName = v },
+		func(stat *LogStat, v string) { stat.BucketTS = v },
+		func(stat *LogStat, v string) { stat.Level = v },
+		func(stat *LogStat, v string) { stat.Logger = v },
+		func(stat *LogStat, v string) { stat.FirstSeenTS = v },
+	}
+	for _, column := range stringColumns {
+		if err := readDictColumn(r, stats, column); err != nil {
+			return nil, err
+		}
+	}
+	for _, stat := range stats {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		stat.N = int(n)
+	}
+	for _, stat := range stats {
+		duration, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		stat.BucketDuration_S = int(duration)
+	}
+
+	return stats, nil
+}
+
+// readDictColumn reads a dictionary encoded string column
+func readDictColumn(r *bufio.Reader, stats []*LogStat, set func(stat *LogStat, v string)) error {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	dict := make([]string, size)
+	for i := range dict {
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		dict[i] = string(buf)
+	}
+
+	for _, stat := range stats {
+		idx, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if idx >= size {
+			return fmt.Errorf("dictionary index %d out of range", idx)
+		}
+		set(stat, dict[idx])
+	}
+	return nil
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	w.Write(buf[:n])
+}
+
+// removeFiles deletes files, ignoring errors
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
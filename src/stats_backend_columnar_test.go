@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnarSegmentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats []*LogStat
+	}{
+		{
+			name:  "empty",
+			stats: []*LogStat{},
+		},
+		{
+			name: "single row",
+			stats: []*LogStat{
+				{HostName: "app1", BucketTS: "2026-10-16T10:00:00+02:00", FirstSeenTS: "2026-10-16T10:00:07+02:00", BucketDuration_S: 60, Level: "ERROR", Logger: "org.example.Service", N: 3},
+			},
+		},
+		{
+			name: "shared dictionary values",
+			stats: []*LogStat{
+				{HostName: "app1", BucketTS: "2026-10-16T10:00:00+02:00", FirstSeenTS: "2026-10-16T10:00:07+02:00", BucketDuration_S: 60, Level: "ERROR", Logger: "org.example.Service", N: 3},
+				{HostName: "app2", BucketTS: "2026-10-16T10:00:00+02:00", FirstSeenTS: "2026-10-16T10:00:01+02:00", BucketDuration_S: 60, Level: "ERROR", Logger: "org.example.Service", N: 1},
+				{HostName: "app1", BucketTS: "2026-10-16T10:01:00+02:00", FirstSeenTS: "2026-10-16T10:01:30+02:00", BucketDuration_S: 30, Level: "INFO", Logger: "org.example.Other", N: 1 << 40},
+			},
+		},
+		{
+			name: "empty and unicode strings",
+			stats: []*LogStat{
+				{HostName: "", BucketTS: "2026-10-16T10:00:00+02:00", Level: "WARN", Logger: "org.example.Ünïcode:tenant=acme", N: 1},
+				{HostName: "app1", BucketTS: "2026-10-16T10:00:00+02:00", Level: "", Logger: strings.Repeat("a.", 500), N: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "seg-1"+columnarSegmentExt)
+			if err := writeColumnarSegment(path, tt.stats); err != nil {
+				t.Fatalf("writeColumnarSegment: %v", err)
+			}
+			got, err := readColumnarSegment(path)
+			if err != nil {
+				t.Fatalf("readColumnarSegment: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.stats) {
+				t.Errorf("round trip mismatch\n got: %v\nwant: %v", got, tt.stats)
+			}
+		})
+	}
+}
+
+func TestColumnarSegmentRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty file", ""},
+		{"wrong magic", "XXXX"},
+		{"truncated gzip stream", columnarMagic + "\x1f\x8b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "seg-1"+columnarSegmentExt)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readColumnarSegment(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// columnarStat returns a one minute bucket of host app1
+func columnarStat(bucketTS, firstSeenTS, level string, duration, n int) *LogStat {
+	return &LogStat{HostName: "app1", BucketTS: bucketTS, FirstSeenTS: firstSeenTS, BucketDuration_S: duration, BucketSize_S: 60, Level: level, Logger: "org.example.Service", N: n}
+}
+
+func TestColumnarBackendMergesSegments(t *testing.T) {
+	manyBatches := make([][]*LogStat, columnarCompactThreshold+5)
+	for i := range manyBatches {
+		manyBatches[i] = []*LogStat{columnarStat("2026-10-16T10:00:00+02:00", fmt.Sprintf("2026-10-16T10:00:%02d+02:00", 59-i), "ERROR", 60, 1)}
+	}
+
+	tests := []struct {
+		name     string
+		batches  [][]*LogStat
+		want     []*LogStat // newest first, ties in write order
+		segments int        // segments of the 2026-10-16 partition
+	}{
+		{
+			name: "counts of the same bucket are added up",
+			batches: [][]*LogStat{
+				{columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:10+02:00", "ERROR", 50, 2)},
+				{columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 60, 3)},
+			},
+			want: []*LogStat{
+				columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 60, 5),
+			},
+			segments: 2,
+		},
+		{
+			name: "first seen keeps the minimum, duration of the latest segment wins",
+			batches: [][]*LogStat{
+				{columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 55, 1)},
+				{columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:30+02:00", "ERROR", 60, 1)},
+			},
+			want: []*LogStat{
+				columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 60, 2),
+			},
+			segments: 2,
+		},
+		{
+			name: "different keys and days stay apart",
+			batches: [][]*LogStat{
+				{
+					columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 60, 1),
+					columnarStat("2026-10-17T10:00:00+02:00", "2026-10-17T10:00:05+02:00", "ERROR", 60, 4),
+				},
+				{columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "INFO", 60, 2)},
+			},
+			want: []*LogStat{
+				columnarStat("2026-10-17T10:00:00+02:00", "2026-10-17T10:00:05+02:00", "ERROR", 60, 4),
+				columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 60, 1),
+				columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "INFO", 60, 2),
+			},
+			segments: 2,
+		},
+		{
+			name:    "compaction keeps the merged counts",
+			batches: manyBatches,
+			want: []*LogStat{
+				columnarStat("2026-10-16T10:00:00+02:00", fmt.Sprintf("2026-10-16T10:00:%02d+02:00", 59-len(manyBatches)+1), "ERROR", 60, len(manyBatches)),
+			},
+			segments: len(manyBatches) - columnarCompactThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := NewColumnarBackend(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewColumnarBackend: %v", err)
+			}
+			defer backend.Close()
+
+			for _, batch := range tt.batches {
+				if err := backend.UpsertStats(batch); err != nil {
+					t.Fatalf("UpsertStats: %v", err)
+				}
+			}
+
+			got, err := backend.QueryStats(StatsQuery{BucketSize: 60})
+			if err != nil {
+				t.Fatalf("QueryStats: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged stats mismatch\n got: %v\nwant: %v", got, tt.want)
+			}
+
+			segments, err := columnarSegments(backend.(*columnarBackend).partitionDir(60, "2026-10-16"))
+			if err != nil {
+				t.Fatalf("columnarSegments: %v", err)
+			}
+			if len(segments) != tt.segments {
+				t.Errorf("got %d segments, want %d", len(segments), tt.segments)
+			}
+		})
+	}
+}
+
+func TestColumnarBackendRecovery(t *testing.T) {
+	stat := columnarStat("2026-10-16T10:00:00+02:00", "2026-10-16T10:00:05+02:00", "ERROR", 60, 1)
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir, partition string) // files left by a crash before the backend is opened
+		wantN int
+	}{
+		{
+			name:  "no leftovers",
+			setup: func(t *testing.T, dir, partition string) {},
+			wantN: 1,
+		},
+		{
+			name: "uncommitted batch is discarded",
+			setup: func(t *testing.T, dir, partition string) {
+				writeTestSegment(t, filepath.Join(partition, "seg-100"+columnarSegmentExt+".tmp"), stat)
+			},
+			wantN: 1,
+		},
+		{
+			name: "committed batch is published",
+			setup: func(t *testing.T, dir, partition string) {
+				writeTestSegment(t, filepath.Join(partition, "seg-100"+columnarSegmentExt+".tmp"), stat)
+				if err := writeCommitMarker(filepath.Join(dir, "commit-100")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantN: 2,
+		},
+		{
+			name: "segments merged into a compacted segment are not counted again",
+			setup: func(t *testing.T, dir, partition string) {
+				writeTestSegment(t, filepath.Join(partition, "seg-100"+columnarSegmentExt), stat)
+				writeTestSegment(t, filepath.Join(partition, "seg-200"+columnarSegmentExt), stat)
+				compacted := *stat
+				compacted.N = 2
+				writeTestSegment(t, filepath.Join(partition, "seg-300-200"+columnarSegmentExt), &compacted)
+			},
+			wantN: 3,
+		},
+		{
+			name: "new segments are not hidden by a compaction written with a clock ahead",
+			setup: func(t *testing.T, dir, partition string) {
+				compacted := *stat
+				compacted.N = 2
+				writeTestSegment(t, filepath.Join(partition, "seg-9000000000000000001-9000000000000000000"+columnarSegmentExt), &compacted)
+			},
+			wantN: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			partition := (&columnarBackend{dir: dir}).partitionDir(60, "2026-10-16")
+			if err := os.MkdirAll(partition, 0755); err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(t, dir, partition)
+
+			backend, err := NewColumnarBackend(dir)
+			if err != nil {
+				t.Fatalf("NewColumnarBackend: %v", err)
+			}
+			defer backend.Close()
+			if err := backend.UpsertStats([]*LogStat{stat}); err != nil {
+				t.Fatalf("UpsertStats: %v", err)
+			}
+
+			got, err := backend.QueryStats(StatsQuery{BucketSize: 60})
+			if err != nil {
+				t.Fatalf("QueryStats: %v", err)
+			}
+			if len(got) != 1 || got[0].N != tt.wantN {
+				t.Fatalf("got %v, want one bucket with n=%d", got, tt.wantN)
+			}
+
+			leftovers, _ := filepath.Glob(filepath.Join(partition, "*.tmp"))
+			markers, _ := filepath.Glob(filepath.Join(dir, "commit-*"))
+			if len(leftovers) > 0 || len(markers) > 0 {
+				t.Errorf("leftovers after recovery: %v %v", leftovers, markers)
+			}
+		})
+	}
+}
+
+// writeTestSegment writes a segment file holding the given stats
+func writeTestSegment(t *testing.T, path string, stats ...*LogStat) {
+	t.Helper()
+	if err := writeColumnarSegment(path, stats); err != nil {
+		t.Fatalf("writeColumnarSegment: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// sqliteBackend stores the buckets in the log_stats table of the SQLite database (default backend).
+// Host, level and logger are stored as IDs of the dimension tables, reads use the log_stats_named view.
+type sqliteBackend struct {
+	db         *sql.DB // connection pool owned by the store
+	dimensions *dimensionCache
+}
+
+// NewSQLiteBackend creates the SQLite backend on the database of the store
+func NewSQLiteBackend(db *sql.DB) StatsBackend {
+	return &sqliteBackend{db: db, dimensions: newDimensionCache()}
+}
+
+func (b *sqliteBackend) Name() string {
+	return "sqlite"
+}
+
+// UpsertStats adds the batch in one transaction, any error rolls back the whole batch
+func (b *sqliteBackend) UpsertStats(stats []*LogStat) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Prepare statement once for reuse (performance optimization)
+	upsertSQL := `
+	INSERT INTO log_stats (host_id, bucket_ts, bucket_duration_s, bucket_size_s, level_id, logger_id, n, first_seen_ts)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(bucket_size_s, host_id, bucket_ts, level_id, logger_id)
+	DO UPDATE SET
+		n = log_stats.n + excluded.n,
+		bucket_duration_s = excluded.bucket_duration_s,
+		first_seen_ts = CASE
+			WHEN log_stats.first_seen_ts = '' THEN excluded.first_seen_ts
+			WHEN excluded.first_seen_ts = '' THEN log_stats.first_seen_ts
+			WHEN log_stats.first_seen_ts < excluded.first_seen_ts THEN log_stats.first_seen_ts
+			ELSE excluded.first_seen_ts
+		END;
+	`
+	stmt, err := tx.Prepare(upsertSQL)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	pending := make(map[string]map[string]int64)
+	for _, stat := range stats {
+		hostID, err := b.dimensions.resolve(tx, "hosts", stat.HostName, pending)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		levelID, err := b.dimensions.resolve(tx, "levels", stat.Level, pending)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		loggerID, err := b.dimensions.resolve(tx, "loggers", stat.Logger, pending)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// A failed row rolls back the batch, so it is retried or merged back as a whole
+		if _, err := stmt.Exec(hostID, stat.BucketTS, stat.BucketDuration_S, stat.BucketSize_S, levelID, loggerID, stat.N, stat.FirstSeenTS); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("upserting log stat: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	b.dimensions.commit(pending)
+	return nil
+}
+
+func (b *sqliteBackend) QueryStats(q StatsQuery) ([]*LogStat, error) {
+	return queryStatsTable(b.db, "log_stats_named", q)
+}
+
+func (b *sqliteBackend) AggregateStats(q StatsQuery) ([]*AggregatedStat, error) {
+	return aggregateStatsTable(b.db, "log_stats_named", q)
+}
+
+func (b *sqliteBackend) GroupStats(q StatsQuery, g GroupBy) ([]*GroupedStat, error) {
+	return groupStatsTable(b.db, "log_stats_named", q, g)
+}
+
+func (b *sqliteBackend) LevelCounts(bucketSize int, since string) (map[string]int64, error) {
+	rows, err := b.db.Query(`
+		SELECT level, COALESCE(SUM(n), 0) as message_count
+		FROM log_stats_named
+		WHERE bucket_size_s = ? AND bucket_ts >= ?
+		GROUP BY level`, bucketSize, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var level string
+		var count int64
+		if err := rows.Scan(&level, &count); err == nil {
+			counts[level] = count
+		}
+	}
+	return counts, rows.Err()
+}
+
+// Cleanup deletes rows older than the retention of their bucket size
+func (b *sqliteBackend) Cleanup(resolutions []BucketResolution) error {
+	// Each resolution has its own retention
+	var configuredSizes []interface{}
+	placeholders := ""
+	for _, res := range resolutions {
+		resCutoff := time.Now().AddDate(0, 0, -res.RetentionDays).Format(time.RFC3339)
+		sizeS := int(res.Size.Seconds())
+
+		result, err := b.db.Exec("DELETE FROM log_stats WHERE bucket_size_s = ? AND bucket_ts < ?", sizeS, resCutoff)
+		if err != nil {
+			log.Printf("    "+"Error cleaning up old data: %v\n", err)
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		log.Printf("    "+"Cleanup: deleted %d %v rows older than %d days\n", rowsAffected, res.Size, res.RetentionDays)
+
+		configuredSizes = append(configuredSizes, sizeS)
+		if placeholders != "" {
+			placeholders += ", "
+		}
+		placeholders += "?"
+	}
+
+	// Resolutions no longer configured follow the primary retention
+	retentionDays := resolutions[0].RetentionDays
+	cutoffDate := time.Now().AddDate(0, 0, -retentionDays).Format(time.RFC3339)
+
+	result, err := b.db.Exec("DELETE FROM log_stats WHERE bucket_size_s NOT IN ("+placeholders+") AND bucket_ts < ?", append(configuredSizes, cutoffDate)...)
+	if err != nil {
+		log.Printf("    "+"Error cleaning up old data: %v\n", err)
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		log.Printf("    "+"Cleanup: deleted %d rows of unconfigured bucket sizes older than %d days\n", rowsAffected, retentionDays)
+	}
+
+	return nil
+}
+
+func (b *sqliteBackend) Stats(bucketSize int) (*BackendStats, error) {
+	stats := &BackendStats{MessagesByLevel: make(map[string]int64)}
+
+	err := b.db.QueryRow(`
+		SELECT count(*), count(distinct bucket_ts), count(distinct level_id), count(distinct logger_id), count(distinct host_id),
+			COALESCE(SUM(n), 0), COALESCE(MIN(bucket_ts), ''), COALESCE(MAX(bucket_ts), '')
+		FROM log_stats WHERE bucket_size_s = ?`, bucketSize).Scan(
+		&stats.Rows, &stats.UniqueBuckets, &stats.UniqueLevels, &stats.UniqueLoggers, &stats.UniqueHosts,
+		&stats.TotalMessages, &stats.OldestBucket, &stats.NewestBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Message counts by level (sum of n, not count of rows)
+	stats.MessagesByLevel, err = b.LevelCounts(bucketSize, "")
+	return stats, err
+}
+
+// Close does nothing, the connection pool is owned by the store
+func (b *sqliteBackend) Close() error {
+	return nil
+}
+
+// statsWhereClause builds the WHERE conditions of a stats query on log_stats or a rollup table
+func statsWhereClause(q StatsQuery) (string, []interface{}) {
+	where := " WHERE 1=1"
+	var args []interface{}
+
+	if q.BucketSize > 0 {
+		where += " AND bucket_size_s = ?"
+		args = append(args, q.BucketSize)
+	}
+	if q.From != "" {
+		where += " AND bucket_ts >= ?"
+		args = append(args, q.From)
+	}
+	if q.Before != "" {
+		where += " AND bucket_ts < ?"
+		args = append(args, q.Before)
+	}
+	if q.Until != "" {
+		where += " AND bucket_ts <= ?"
+		args = append(args, q.Until)
+	}
+
+	if q.Level != "" {
+		where += " AND level = ?"
+		args = append(args, q.Level)
+	}
+
+	if q.LoggerRegex != "" {
+		condition, regexArgs := regexCondition("logger", q.LoggerRegex)
+		where += condition
+		args = append(args, regexArgs...)
+	}
+
+	dimensionWhere, dimensionArgs := q.Dimensions.sqlConditions("hostname", "level", "logger")
+	where += dimensionWhere
+	args = append(args, dimensionArgs...)
+
+	return where, args
+}
+
+// queryStatsTable queries buckets of log_stats_named or a rollup table with SQL-level filtering
+func queryStatsTable(db *sql.DB, table string, q StatsQuery) ([]*LogStat, error) {
+	where, args := statsWhereClause(q)
+	query := "SELECT id, hostname, bucket_ts, bucket_duration_s, level, logger, n, first_seen_ts FROM " + table + where
+	query += " ORDER BY bucket_ts DESC"
+
+	// Apply LIMIT
+	if q.MaxResults > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.MaxResults)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*LogStat
+	for rows.Next() {
+		stat := &LogStat{}
+		if err := rows.Scan(&stat.ID, &stat.HostName, &stat.BucketTS, &stat.BucketDuration_S, &stat.Level, &stat.Logger, &stat.N, &stat.FirstSeenTS); err != nil {
+			log.Printf("Error scanning row: %v\n", err)
+			continue
+		}
+		stat.BucketSize_S = q.BucketSize
+
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+// aggregateStatsTable aggregates buckets of log_stats_named or a rollup table using SQL GROUP BY
+func aggregateStatsTable(db *sql.DB, table string, q StatsQuery) ([]*AggregatedStat, error) {
+	where, args := statsWhereClause(q)
+	query := `
+		SELECT
+			hostname,
+			bucket_ts,
+			level,
+			SUM(n) as total_count,
+			COUNT(DISTINCT logger) as logger_count,
+			MIN(first_seen_ts) as first_seen_ts
+		FROM ` + table + where
+	query += " GROUP BY hostname, bucket_ts, level"
+	query += " ORDER BY bucket_ts DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Read aggregated rows directly
+	var aggregated []*AggregatedStat
+	for rows.Next() {
+		agg := &AggregatedStat{}
+		if err := rows.Scan(&agg.HostName, &agg.BucketTS, &agg.Level, &agg.TotalCount, &agg.LoggerCount, &agg.FirstSeenTS); err != nil {
+			log.Printf("Error scanning aggregated row: %v\n", err)
+			continue
+		}
+		aggregated = append(aggregated, agg)
+	}
+
+	// Apply max results filter if specified
+	if q.MaxResults > 0 && len(aggregated) > q.MaxResults {
+		aggregated = aggregated[:q.MaxResults]
+	}
+
+	return aggregated, rows.Err()
+}
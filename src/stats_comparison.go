@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comparison limits and defaults
+const (
+	maxBaselineWeeks     = 12
+	defaultCompareWindow = 24 * time.Hour
+	maxCompareOffsetDays = 366
+)
+
+// Comparison selects the earlier values returned with each bucket of a grouped query
+type Comparison struct {
+	OffsetDays    int // compare with the same bucket this many days earlier (0 = none)
+	BaselineWeeks int // baseline = median of the same bucket in each of the last BaselineWeeks weeks (0 = none)
+}
+
+// ComparedStat is a group of a bucket with its earlier values
+type ComparedStat struct {
+	GroupedStat
+	PreviousCount *int     `json:"PreviousCount,omitempty"` // count of the same bucket OffsetDays earlier
+	Baseline      *float64 `json:"Baseline,omitempty"`      // median count at the same time of week
+}
+
+// ParseComparison parses the compare offset ("1d", "7d", "2w") and the number of baseline weeks
+func ParseComparison(offset, weeks string) (Comparison, error) {
+	var c Comparison
+	if offset != "" {
+		unit := 1
+		number := offset
+		switch {
+		case strings.HasSuffix(offset, "d"):
+			number = strings.TrimSuffix(offset, "d")
+		case strings.HasSuffix(offset, "w"):
+			number = strings.TrimSuffix(offset, "w")
+			unit = 7
+		default:
+			number = ""
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil || n <= 0 || n*unit > maxCompareOffsetDays {
+			return c, fmt.Errorf("invalid compare %q: use days (\"1d\") or weeks (\"1w\") up to %d days", offset, maxCompareOffsetDays)
+		}
+		c.OffsetDays = n * unit
+	}
+	if weeks != "" {
+		n, err := strconv.Atoi(weeks)
+		if err != nil || n < 0 || n > maxBaselineWeeks {
+			return c, fmt.Errorf("invalid baseline_weeks %q: must be between 0 and %d", weeks, maxBaselineWeeks)
+		}
+		c.BaselineWeeks = n
+	}
+	if c.OffsetDays == 0 && c.BaselineWeeks == 0 {
+		return c, fmt.Errorf("comparison needs compare or baseline_weeks")
+	}
+	return c, nil
+}
+
+// shiftDays moves the time filters back by the given number of calendar days (same local time of day)
+func shiftDays(filter QueryFilter, days int) QueryFilter {
+	filter.StartTime = filter.StartTime.Local().AddDate(0, 0, -days)
+	filter.EndTime = filter.EndTime.Local().AddDate(0, 0, -days)
+	return filter
+}
+
+// shiftBucketTS moves a bucket timestamp forward by the given number of calendar days
+func shiftBucketTS(bucketTS string, days int) string {
+	bucketTime, err := time.Parse(time.RFC3339, bucketTS)
+	if err != nil {
+		return bucketTS
+	}
+	return bucketTime.Local().AddDate(0, 0, days).Format(time.RFC3339)
+}
+
+// median returns the median of the values
+func median(values []int) float64 {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return float64(sorted[n/2])
+	}
+	return float64(sorted[n/2-1]+sorted[n/2]) / 2
+}
+
+// QueryComparison aggregates the matching buckets like QueryGroupedStats (always grouped by bucket) and
+// adds the count of the same bucket OffsetDays earlier and the median of the same bucket in the last
+// BaselineWeeks weeks. Buckets without messages in the selected range are included when an earlier
+// window has messages, so drops show up. The range defaults to the last 24 hours.
+func (s *LogStatStore) QueryComparison(filter QueryFilter, g GroupBy, c Comparison) ([]*ComparedStat, error) {
+	g.Bucket = true
+	if filter.EndTime.IsZero() {
+		filter.EndTime = time.Now()
+	}
+	if filter.StartTime.IsZero() {
+		filter.StartTime = filter.EndTime.Add(-defaultCompareWindow)
+	}
+
+	// All windows at the resolution of the oldest one, so their buckets line up
+	oldest := c.OffsetDays
+	if days := 7 * c.BaselineWeeks; days > oldest {
+		oldest = days
+	}
+	res, err := s.pickResolution(shiftDays(filter, oldest))
+	if err != nil {
+		return nil, err
+	}
+	filter.Resolution = res.name()
+
+	groups, _, err := s.queryGroups(filter, g)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]*ComparedStat)
+	ordered := []*ComparedStat{}
+	for _, group := range groups {
+		stat := &ComparedStat{GroupedStat: *group}
+		results[group.key()] = stat
+		ordered = append(ordered, stat)
+	}
+
+	// earlierCounts returns the counts of the window the given days earlier, keyed by the group of the
+	// corresponding bucket in the selected range
+	earlierCounts := func(days int) (map[string]int, error) {
+		earlier, _, err := s.queryGroups(shiftDays(filter, days), g)
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int)
+		for _, group := range earlier {
+			group.BucketTS = shiftBucketTS(group.BucketTS, days)
+			key := group.key()
+			counts[key] += group.TotalCount
+			if _, exists := results[key]; !exists {
+				stat := &ComparedStat{GroupedStat: GroupedStat{
+					HostName: group.HostName,
+					BucketTS: group.BucketTS,
+					Level:    group.Level,
+					Logger:   group.Logger,
+				}}
+				results[key] = stat
+				ordered = append(ordered, stat)
+			}
+		}
+		return counts, nil
+	}
+
+	var previous map[string]int
+	if c.OffsetDays > 0 {
+		if previous, err = earlierCounts(c.OffsetDays); err != nil {
+			return nil, err
+		}
+	}
+	weekly := make([]map[string]int, c.BaselineWeeks)
+	for week := range weekly {
+		if weekly[week], err = earlierCounts(7 * (week + 1)); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, stat := range results {
+		if previous != nil {
+			count := previous[key]
+			stat.PreviousCount = &count
+		}
+		if len(weekly) > 0 {
+			values := make([]int, len(weekly))
+			for week, counts := range weekly {
+				values[week] = counts[key]
+			}
+			baseline := median(values)
+			stat.Baseline = &baseline
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].BucketTS != ordered[j].BucketTS {
+			return ordered[i].BucketTS > ordered[j].BucketTS
+		}
+		if ordered[i].TotalCount != ordered[j].TotalCount {
+			return ordered[i].TotalCount > ordered[j].TotalCount
+		}
+		return ordered[i].key() < ordered[j].key()
+	})
+
+	if filter.MaxResults > 0 && len(ordered) > filter.MaxResults {
+		ordered = ordered[:filter.MaxResults]
+	}
+
+	return ordered, nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DimensionFilter holds the multi-value and exclusion filters of stats queries. Host and logger
+// patterns are globs (* any text, ? one character, [abc] character class, {a,b} alternatives).
+// Globs are translated to one anchored regex per list, matched with the Go regex engine in memory
+// and the REGEXP function in SQL, so both apply the same semantics.
+type DimensionFilter struct {
+	Levels             []string // levels to include, exact names (empty = all)
+	ExcludeLevels      []string // levels to exclude
+	MinLevel           string   // minimum severity, e.g. "WARN" for WARN, ERROR and FATAL ("" = none)
+	Hosts              []string // host globs to include (empty = all)
+	ExcludeHosts       []string // host globs to exclude
+	Loggers            []string // logger globs to include (empty = all)
+	ExcludeLoggers     []string // logger globs to exclude
+	ExcludeLoggerRegex string   // regex of logger names to exclude ("" = none)
+}
+
+// dimensionMatcher is a compiled DimensionFilter
+type dimensionMatcher struct {
+	levels             map[string]bool // nil = all
+	excludeLevels      map[string]bool
+	minSeverity        int // -1 = none
+	hosts              *regexp.Regexp
+	excludeHosts       *regexp.Regexp
+	loggers            *regexp.Regexp
+	excludeLoggers     *regexp.Regexp
+	excludeLoggerRegex *regexp.Regexp
+}
+
+// IsZero reports whether the filter has no conditions
+func (f DimensionFilter) IsZero() bool {
+	return len(f.Levels) == 0 && len(f.ExcludeLevels) == 0 && f.MinLevel == "" &&
+		len(f.Hosts) == 0 && len(f.ExcludeHosts) == 0 && len(f.Loggers) == 0 && len(f.ExcludeLoggers) == 0 &&
+		f.ExcludeLoggerRegex == ""
+}
+
+// compile validates the filter and compiles its patterns (nil if the filter has no conditions)
+func (f DimensionFilter) compile() (*dimensionMatcher, error) {
+	if f.IsZero() {
+		return nil, nil
+	}
+
+	m := &dimensionMatcher{minSeverity: -1}
+	if len(f.Levels) > 0 {
+		m.levels = make(map[string]bool)
+		for _, level := range f.Levels {
+			m.levels[level] = true
+		}
+	}
+	m.excludeLevels = make(map[string]bool)
+	for _, level := range f.ExcludeLevels {
+		m.excludeLevels[level] = true
+	}
+	if f.MinLevel != "" {
+		if m.minSeverity = levelSeverity(f.MinLevel); m.minSeverity < 0 {
+			return nil, fmt.Errorf("invalid min level %q. Allowed values: TRACE, DEBUG, INFO, WARN, ERROR, FATAL", f.MinLevel)
+		}
+	}
+
+	var err error
+	if m.hosts, err = compileGlobList(f.Hosts); err != nil {
+		return nil, err
+	}
+	if m.excludeHosts, err = compileGlobList(f.ExcludeHosts); err != nil {
+		return nil, err
+	}
+	if m.loggers, err = compileGlobList(f.Loggers); err != nil {
+		return nil, err
+	}
+	if m.excludeLoggers, err = compileGlobList(f.ExcludeLoggers); err != nil {
+		return nil, err
+	}
+	if m.excludeLoggerRegex, err = compileLoggerRegex(f.ExcludeLoggerRegex); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// matches reports whether a bucket passes all conditions (a nil matcher passes everything)
+func (m *dimensionMatcher) matches(host, level, logger string) bool {
+	if m == nil {
+		return true
+	}
+	if m.levels != nil && !m.levels[level] {
+		return false
+	}
+	if m.excludeLevels[level] {
+		return false
+	}
+	if m.minSeverity >= 0 && levelSeverity(level) < m.minSeverity {
+		return false
+	}
+	if m.hosts != nil && !m.hosts.MatchString(host) {
+		return false
+	}
+	if m.excludeHosts != nil && m.excludeHosts.MatchString(host) {
+		return false
+	}
+	if m.loggers != nil && !m.loggers.MatchString(logger) {
+		return false
+	}
+	if m.excludeLoggers != nil && m.excludeLoggers.MatchString(logger) {
+		return false
+	}
+	if m.excludeLoggerRegex != nil && m.excludeLoggerRegex.MatchString(logger) {
+		return false
+	}
+	return true
+}
+
+// sqlConditions returns the SQL conditions (each starting with " AND") of the filter for the given
+// host, level and logger columns. The filter must have been validated with compile.
+func (f DimensionFilter) sqlConditions(hostColumn, levelColumn, loggerColumn string) (string, []interface{}) {
+	where := ""
+	var args []interface{}
+
+	if len(f.Levels) > 0 {
+		where += " AND " + levelColumn + " IN (" + sqlPlaceholders(len(f.Levels)) + ")"
+		for _, level := range f.Levels {
+			args = append(args, level)
+		}
+	}
+	if len(f.ExcludeLevels) > 0 {
+		where += " AND " + levelColumn + " NOT IN (" + sqlPlaceholders(len(f.ExcludeLevels)) + ")"
+		for _, level := range f.ExcludeLevels {
+			args = append(args, level)
+		}
+	}
+
+	// Level names ranked at least the minimum severity (unknown levels never match)
+	if f.MinLevel != "" {
+		minSeverity := levelSeverity(f.MinLevel)
+		var names []string
+		for name, severity := range levelSeverities {
+			if severity >= minSeverity {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		where += " AND upper(" + levelColumn + ") IN (" + sqlPlaceholders(len(names)) + ")"
+		for _, name := range names {
+			args = append(args, name)
+		}
+	}
+
+	for _, cond := range []struct {
+		column  string
+		pattern string
+		negate  bool
+	}{
+		{hostColumn, globListRegex(f.Hosts), false},
+		{hostColumn, globListRegex(f.ExcludeHosts), true},
+		{loggerColumn, globListRegex(f.Loggers), false},
+		{loggerColumn, globListRegex(f.ExcludeLoggers), true},
+		{loggerColumn, f.ExcludeLoggerRegex, true},
+	} {
+		switch {
+		case cond.pattern == "":
+		case cond.negate:
+			where += " AND NOT (" + cond.column + " REGEXP ?)"
+			args = append(args, cond.pattern)
+		default:
+			condition, regexArgs := regexCondition(cond.column, cond.pattern)
+			where += condition
+			args = append(args, regexArgs...)
+		}
+	}
+
+	return where, args
+}
+
+// sqlPlaceholders returns n comma-separated placeholders
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// compileGlobList compiles a list of globs to one regex (nil if the list is empty)
+func compileGlobList(globs []string) (*regexp.Regexp, error) {
+	pattern := globListRegex(globs)
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob in %q: %v", strings.Join(globs, ","), err)
+	}
+	return re, nil
+}
+
+// globListRegex translates a list of globs to an anchored regex matching any of them ("" if empty)
+func globListRegex(globs []string) string {
+	if len(globs) == 0 {
+		return ""
+	}
+	alternatives := make([]string, len(globs))
+	for i, g := range globs {
+		alternatives[i] = globToRegex(g)
+	}
+	return "^(?:" + strings.Join(alternatives, "|") + ")$"
+}
+
+// globToRegex translates a glob to an unanchored regex: * any text, ? one character, [abc] or [!abc]
+// character classes, {a,b} alternatives, \x a literal x; everything else (including an unterminated
+// "[") matches literally
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	braces := 0
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '*':
+			sb.WriteString(".*")
+		case r == '?':
+			sb.WriteString(".")
+		case r == '{':
+			braces++
+			sb.WriteString("(?:")
+		case r == '}' && braces > 0:
+			braces--
+			sb.WriteString(")")
+		case r == ',' && braces > 0:
+			sb.WriteString("|")
+		case r == '[':
+			// A ']' right after "[" or "[!" is part of the class, an unterminated class is a literal "["
+			start := i + 1
+			if start < len(runes) && runes[start] == '!' {
+				start++
+			}
+			end := -1
+			for j := start + 1; j < len(runes); j++ {
+				if runes[j] == ']' {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			sb.WriteString("[")
+			if start > i+1 {
+				sb.WriteString("^")
+			}
+			for _, c := range runes[start:end] {
+				if c == '\\' || c == '[' || c == ']' {
+					sb.WriteRune('\\')
+				}
+				sb.WriteRune(c)
+			}
+			sb.WriteString("]")
+			i = end
+		case r == '\\' && i+1 < len(runes):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	for ; braces > 0; braces-- {
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob    string
+		want    string
+		match   []string
+		noMatch []string
+	}{
+		{glob: "org.example.*", want: `org\.example\..*`, match: []string{"org.example.", "org.example.Service"}, noMatch: []string{"orgXexample.Service", "com.example.Service"}},
+		{glob: "app?", want: `app.`, match: []string{"app1", "appX"}, noMatch: []string{"app", "app12"}},
+		{glob: "app[12]", want: `app[12]`, match: []string{"app1", "app2"}, noMatch: []string{"app3", "app12"}},
+		{glob: "app[0-9]", want: `app[0-9]`, match: []string{"app0", "app7"}, noMatch: []string{"appa"}},
+		{glob: "app[!12]", want: `app[^12]`, match: []string{"app3", "appx"}, noMatch: []string{"app1", "app2"}},
+		{glob: "a[]]b", want: `a[\]]b`, match: []string{"a]b"}, noMatch: []string{"ab", "a[b"}},
+		{glob: "a[!]]b", want: `a[^\]]b`, match: []string{"axb"}, noMatch: []string{"a]b"}},
+		{glob: "a[[]b", want: `a[\[]b`, match: []string{"a[b"}, noMatch: []string{"ab"}},
+		{glob: `a[\]b`, want: `a[\\]b`, match: []string{`a\b`}, noMatch: []string{"ab"}},
+		{glob: "{app,web}*", want: `(?:app|web).*`, match: []string{"app1", "web", "webserver"}, noMatch: []string{"db1", "ap"}},
+		{glob: "{a,{b,c}}x", want: `(?:a|(?:b|c))x`, match: []string{"ax", "bx", "cx"}, noMatch: []string{"dx", "x"}},
+		{glob: "{a,b", want: `(?:a|b)`, match: []string{"a", "b"}, noMatch: []string{"{a,b"}},
+		{glob: "a,b}", want: `a,b\}`, match: []string{"a,b}"}, noMatch: []string{"a", "b"}},
+		{glob: `\*`, want: `\*`, match: []string{"*"}, noMatch: []string{"x", ""}},
+		{glob: `a\?b`, want: `a\?b`, match: []string{"a?b"}, noMatch: []string{"axb"}},
+		{glob: `\{a,b\}`, want: `\{a,b\}`, match: []string{"{a,b}"}, noMatch: []string{"a", "b"}},
+		{glob: `a\`, want: `a\\`, match: []string{`a\`}, noMatch: []string{"a"}},
+		{glob: "a[b", want: `a\[b`, match: []string{"a[b"}, noMatch: []string{"ab"}},
+		{glob: "[", want: `\[`, match: []string{"["}, noMatch: []string{""}},
+		{glob: "[]", want: `\[\]`, match: []string{"[]"}, noMatch: []string{""}},
+		{glob: "[!]", want: `\[!\]`, match: []string{"[!]"}, noMatch: []string{"x"}},
+		{glob: "a|b(c)+", want: `a\|b\(c\)\+`, match: []string{"a|b(c)+"}, noMatch: []string{"a", "bc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			got := globToRegex(tt.glob)
+			if got != tt.want {
+				t.Errorf("globToRegex(%q) = %q, want %q", tt.glob, got, tt.want)
+			}
+			re, err := regexp.Compile("^(?:" + got + ")$")
+			if err != nil {
+				t.Fatalf("regex %q of glob %q does not compile: %v", got, tt.glob, err)
+			}
+			for _, s := range tt.match {
+				if !re.MatchString(s) {
+					t.Errorf("glob %q does not match %q", tt.glob, s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if re.MatchString(s) {
+					t.Errorf("glob %q matches %q", tt.glob, s)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobListRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		globs   []string
+		want    string
+		match   []string
+		noMatch []string
+	}{
+		{name: "empty", globs: nil, want: ""},
+		{name: "anchored", globs: []string{"app*"}, want: `^(?:app.*)$`, match: []string{"app1"}, noMatch: []string{"webapp1"}},
+		{name: "any of the globs", globs: []string{"app*", "db?"}, want: `^(?:app.*|db.)$`, match: []string{"app1", "db1"}, noMatch: []string{"db12", "web"}},
+		{name: "unclosed brace stays within its glob", globs: []string{"{a,b", "c"}, want: `^(?:(?:a|b)|c)$`, match: []string{"a", "b", "c"}, noMatch: []string{"bc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := globListRegex(tt.globs)
+			if got != tt.want {
+				t.Errorf("globListRegex(%q) = %q, want %q", tt.globs, got, tt.want)
+			}
+			if got == "" {
+				return
+			}
+			re := regexp.MustCompile(got)
+			for _, s := range tt.match {
+				if !re.MatchString(s) {
+					t.Errorf("%q does not match %q", got, s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if re.MatchString(s) {
+					t.Errorf("%q matches %q", got, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlite "modernc.org/sqlite"
+)
+
+// errInvalidQuery is returned for invalid filter, resolution and grouping parameters of a query
+var errInvalidQuery = errors.New("invalid query")
+
+func init() {
+	// Grouping expressions, shared by SQL and in-memory grouping so both produce the same groups
+	sqlite.MustRegisterDeterministicScalarFunction("logger_prefix", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		logger, _ := args[0].(string)
+		depth, _ := args[1].(int64)
+		return loggerPrefix(logger, int(depth)), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("bucket_start", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		bucketTS, _ := args[0].(string)
+		sizeS, _ := args[1].(int64)
+		return rebucketTS(bucketTS, time.Duration(sizeS)*time.Second), nil
+	})
+}
+
+// GroupBy selects the dimensions of a grouped aggregation
+type GroupBy struct {
+	Host        bool
+	Level       bool
+	Logger      bool
+	LoggerDepth int // group loggers by their first LoggerDepth dot-separated name components (0 = full name)
+	Bucket      bool
+	BucketSize  time.Duration // rebucket to this size (0 = bucket size of the query resolution)
+}
+
+// GroupedStat is the message count of one group. Dimensions not grouped by are empty.
+type GroupedStat struct {
+	HostName    string `json:"HostName,omitempty"`
+	BucketTS    string `json:"BucketTS,omitempty"`
+	Level       string `json:"Level,omitempty"`
+	Logger      string `json:"Logger,omitempty"` // logger name or prefix
+	TotalCount  int    `json:"TotalCount"`
+	LoggerCount int    `json:"LoggerCount"` // distinct loggers (memory and database parts added up)
+	FirstSeenTS string `json:"FirstSeenTS"`
+}
+
+// ParseGroupBy parses a comma-separated group_by list of host, level, logger, logger_prefix:<depth>,
+// bucket and bucket:<size>, e.g. "logger_prefix:3,level,bucket:1h"
+func ParseGroupBy(spec string) (GroupBy, error) {
+	var g GroupBy
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		name, arg, hasArg := strings.Cut(item, ":")
+		switch {
+		case item == "":
+			continue
+		case item == "host":
+			g.Host = true
+		case item == "level":
+			g.Level = true
+		case item == "logger":
+			g.Logger = true
+		case name == "logger_prefix" && hasArg:
+			depth, err := strconv.Atoi(arg)
+			if err != nil || depth <= 0 {
+				return g, fmt.Errorf("invalid group_by %q: depth must be a positive number", item)
+			}
+			g.Logger = true
+			g.LoggerDepth = depth
+		case item == "bucket":
+			g.Bucket = true
+		case name == "bucket" && hasArg:
+			size, err := time.ParseDuration(arg)
+			if err != nil || size <= 0 {
+				return g, fmt.Errorf("invalid group_by %q: invalid bucket size", item)
+			}
+			g.Bucket = true
+			g.BucketSize = size
+		default:
+			return g, fmt.Errorf("invalid group_by %q. Allowed values: host, level, logger, logger_prefix:<depth>, bucket, bucket:<size>", item)
+		}
+	}
+	if !g.Host && !g.Level && !g.Logger && !g.Bucket {
+		return g, fmt.Errorf("group_by needs at least one of host, level, logger, logger_prefix:<depth>, bucket")
+	}
+	return g, nil
+}
+
+// sqlColumns returns the SQL expressions of host, bucket, level and logger group values
+// (an empty string literal for dimensions not grouped by)
+func (g GroupBy) sqlColumns() []string {
+	columns := []string{"''", "''", "''", "''"}
+	if g.Host {
+		columns[0] = "hostname"
+	}
+	if g.Bucket {
+		columns[1] = "bucket_ts"
+		if g.BucketSize > 0 {
+			columns[1] = fmt.Sprintf("bucket_start(bucket_ts, %d)", int(g.BucketSize.Seconds()))
+		}
+	}
+	if g.Level {
+		columns[2] = "level"
+	}
+	if g.Logger {
+		columns[3] = "logger"
+		if g.LoggerDepth > 0 {
+			columns[3] = fmt.Sprintf("logger_prefix(logger, %d)", g.LoggerDepth)
+		}
+	}
+	return columns
+}
+
+// group returns the empty group of a bucket
+func (g GroupBy) group(stat *LogStat) *GroupedStat {
+	group := &GroupedStat{}
+	if g.Host {
+		group.HostName = stat.HostName
+	}
+	if g.Bucket {
+		group.BucketTS = stat.BucketTS
+		if g.BucketSize > 0 {
+			group.BucketTS = rebucketTS(stat.BucketTS, g.BucketSize)
+		}
+	}
+	if g.Level {
+		group.Level = stat.Level
+	}
+	if g.Logger {
+		group.Logger = stat.Logger
+		if g.LoggerDepth > 0 {
+			group.Logger = loggerPrefix(stat.Logger, g.LoggerDepth)
+		}
+	}
+	return group
+}
+
+// key returns the map key of a group
+func (group *GroupedStat) key() string {
+	return group.HostName + ":" + group.BucketTS + ":" + group.Level + ":" + group.Logger
+}
+
+// loggerPrefix returns the first depth dot-separated components of a logger name without its promoted
+// fields (the full name if depth is 0)
+func loggerPrefix(logger string, depth int) string {
+	if depth <= 0 {
+		return logger
+	}
+	// Promoted fields (":name=value") are not part of the logger hierarchy
+	if i := strings.IndexByte(logger, ':'); i >= 0 {
+		logger = logger[:i]
+	}
+	end := -1
+	for i := 0; i < depth; i++ {
+		next := strings.IndexByte(logger[end+1:], '.')
+		if next < 0 {
+			return logger
+		}
+		end += next + 1
+	}
+	return logger[:end]
+}
+
+// rebucketTS returns the start of the bucket of the given size containing a bucket timestamp
+// (the timestamp itself if it cannot be parsed)
+func rebucketTS(bucketTS string, bucketSize time.Duration) string {
+	bucketTime, err := time.Parse(time.RFC3339, bucketTS)
+	if err != nil || bucketSize <= 0 {
+		return bucketTS
+	}
+	return getBucketTime(bucketTime.Local(), bucketSize).Format(time.RFC3339)
+}
+
+// groupStats groups buckets in memory with the semantics of groupStatsTable
+func groupStats(stats []*LogStat, g GroupBy) []*GroupedStat {
+	groups := make(map[string]*GroupedStat)
+	loggers := make(map[string]map[string]bool)
+
+	for _, stat := range stats {
+		group := g.group(stat)
+		key := group.key()
+		if existing, exists := groups[key]; exists {
+			group = existing
+		} else {
+			groups[key] = group
+			loggers[key] = make(map[string]bool)
+		}
+
+		group.TotalCount += stat.N
+		if stat.FirstSeenTS != "" && (group.FirstSeenTS == "" || stat.FirstSeenTS < group.FirstSeenTS) {
+			group.FirstSeenTS = stat.FirstSeenTS
+		}
+		if !loggers[key][stat.Logger] {
+			loggers[key][stat.Logger] = true
+			group.LoggerCount++
+		}
+	}
+
+	results := make([]*GroupedStat, 0, len(groups))
+	for _, group := range groups {
+		results = append(results, group)
+	}
+	return results
+}
+
+// groupStatsTable groups buckets of log_stats_named or a rollup table using SQL GROUP BY
+func groupStatsTable(db *sql.DB, table string, q StatsQuery, g GroupBy) ([]*GroupedStat, error) {
+	where, args := statsWhereClause(q)
+	query := `
+		SELECT
+			` + strings.Join(g.sqlColumns(), ", ") + `,
+			SUM(n) as total_count,
+			COUNT(DISTINCT logger) as logger_count,
+			MIN(first_seen_ts) as first_seen_ts
+		FROM ` + table + where
+	query += " GROUP BY 1, 2, 3, 4"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*GroupedStat
+	for rows.Next() {
+		group := &GroupedStat{}
+		if err := rows.Scan(&group.HostName, &group.BucketTS, &group.Level, &group.Logger, &group.TotalCount, &group.LoggerCount, &group.FirstSeenTS); err != nil {
+			log.Printf("Error scanning grouped row: %v\n", err)
+			continue
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// mergeGroups merges groups with the same key from memory and database parts
+func mergeGroups(groups []*GroupedStat) []*GroupedStat {
+	merged := make(map[string]*GroupedStat)
+	var results []*GroupedStat
+
+	for _, group := range groups {
+		key := group.key()
+		existing, exists := merged[key]
+		if !exists {
+			merged[key] = group
+			results = append(results, group)
+			continue
+		}
+		existing.TotalCount += group.TotalCount
+		existing.LoggerCount += group.LoggerCount
+		if group.FirstSeenTS != "" && (existing.FirstSeenTS == "" || group.FirstSeenTS < existing.FirstSeenTS) {
+			existing.FirstSeenTS = group.FirstSeenTS
+		}
+	}
+
+	return results
+}
+
+// QueryGroupedStats aggregates the matching buckets by the given dimensions. Groups are ordered by
+// bucket (newest first, if grouped by bucket), then by count.
+func (s *LogStatStore) QueryGroupedStats(filter QueryFilter, g GroupBy) ([]*GroupedStat, error) {
+	groups, _, err := s.queryGroups(filter, g)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].BucketTS != groups[j].BucketTS {
+			return groups[i].BucketTS > groups[j].BucketTS
+		}
+		if groups[i].TotalCount != groups[j].TotalCount {
+			return groups[i].TotalCount > groups[j].TotalCount
+		}
+		return groups[i].key() < groups[j].key()
+	})
+
+	if filter.MaxResults > 0 && len(groups) > filter.MaxResults {
+		groups = groups[:filter.MaxResults]
+	}
+
+	return groups, nil
+}
+
+// queryGroups returns the unordered groups of the matching buckets (filter.MaxResults is ignored)
+// and the bucket size of the query resolution
+func (s *LogStatStore) queryGroups(filter QueryFilter, g GroupBy) ([]*GroupedStat, time.Duration, error) {
+	if _, err := compileLoggerRegex(filter.LoggerRegex); err != nil {
+		return nil, 0, fmt.Errorf("%w: logger_regex: %v", errInvalidQuery, err)
+	}
+	if _, err := filter.Dimensions.compile(); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errInvalidQuery, err)
+	}
+
+	// Pick resolution once so memory and database parts match
+	res, err := s.pickResolution(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.Resolution = res.name()
+	if res.tier != nil && !filter.StartTime.IsZero() {
+		filter.StartTime = getBucketTime(filter.StartTime.Local(), res.tier.BucketSize)
+	}
+
+	// Groups are at least as coarse as the query resolution; finer segments of a tier query are
+	// rebucketed to the tier size
+	if g.Bucket {
+		resolution := res.bucketSize()
+		switch {
+		case g.BucketSize == 0 && res.tier != nil:
+			g.BucketSize = resolution
+		case g.BucketSize == 0:
+		case g.BucketSize < resolution || g.BucketSize%resolution != 0 || (24*time.Hour)%g.BucketSize != 0:
+			return nil, 0, fmt.Errorf("%w: group_by bucket %v must be a multiple of the query resolution %v that divides a day", errInvalidQuery, g.BucketSize, resolution)
+		}
+	}
+
+	var groups []*GroupedStat
+
+	// Group in-memory data
+	if filter.IncludeMemory {
+		memoryStats, err := s.QueryLogStats(QueryFilter{
+			Level:         filter.Level,
+			LoggerRegex:   filter.LoggerRegex,
+			StartTime:     filter.StartTime,
+			EndTime:       filter.EndTime,
+			IncludeMemory: true,
+			IncludeDB:     false,
+			Resolution:    filter.Resolution,
+			Dimensions:    filter.Dimensions,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, groupStats(memoryStats, g)...)
+	}
+
+	// Group database data using SQL
+	if filter.IncludeDB {
+		for _, segment := range s.querySegments(res) {
+			q := newStatsQuery(segment, filter)
+			q.MaxResults = 0
+
+			var dbGroups []*GroupedStat
+			if segment.table == "log_stats" {
+				dbGroups, err = s.backend.GroupStats(q, g)
+			} else {
+				dbGroups, err = groupStatsTable(s.db, segment.table, q, g)
+			}
+			if err != nil {
+				log.Printf("Error querying grouped database: %v\n", err)
+				continue
+			}
+			groups = append(groups, dbGroups...)
+		}
+	}
+
+	return mergeGroups(groups), res.bucketSize(), nil
+}
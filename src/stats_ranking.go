@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Ranking defaults of the top and movers queries
+const (
+	defaultRankingLimit = 10
+	defaultMoversOffset = 24 * time.Hour
+	defaultMoversWindow = time.Hour
+	defaultMinVolume    = 10
+)
+
+// errInvalidRanking is returned for invalid top and movers parameters
+var errInvalidRanking = errors.New("invalid ranking")
+
+// TopQuery ranks groups of the matching buckets
+type TopQuery struct {
+	By     GroupBy // dimensions of the ranked groups
+	Within GroupBy // partition the ranking (and shares) by these dimensions of By (zero = one overall ranking)
+	RankBy string  // "total", "rate" or "share"
+	Limit  int     // entries per partition
+}
+
+// TopEntry is a ranked group
+type TopEntry struct {
+	GroupedStat
+	Rate  float64 `json:"Rate"`  // messages per minute while active (total / duration of the buckets with messages)
+	Share float64 `json:"Share"` // fraction of the partition total (0..1)
+	Rank  int     `json:"Rank"`  // 1-based rank within the partition
+}
+
+// MoversQuery compares the groups of two time windows of equal length
+type MoversQuery struct {
+	By        GroupBy
+	Offset    time.Duration // baseline window = current window shifted back by Offset
+	MinVolume int           // ignore groups with fewer messages in both windows
+	SortBy    string        // "absolute" or "relative" change
+	Direction string        // "up", "down" or "" for both
+	Limit     int
+}
+
+// Mover is the change of one group between the baseline and the current window
+type Mover struct {
+	HostName       string   `json:"HostName,omitempty"`
+	Level          string   `json:"Level,omitempty"`
+	Logger         string   `json:"Logger,omitempty"`
+	Current        int      `json:"Current"`
+	Baseline       int      `json:"Baseline"`
+	Change         int      `json:"Change"`
+	RelativeChange *float64 `json:"RelativeChange"` // (current - baseline) / baseline, null for new groups
+}
+
+// MoversResult holds the compared windows and the groups that changed most
+type MoversResult struct {
+	CurrentStart  string   `json:"CurrentStart"`
+	CurrentEnd    string   `json:"CurrentEnd"`
+	BaselineStart string   `json:"BaselineStart"`
+	BaselineEnd   string   `json:"BaselineEnd"`
+	Movers        []*Mover `json:"Movers"`
+}
+
+// validateRankingGroups checks the dimensions of a ranking, rankings are over a whole time range
+func validateRankingGroups(by GroupBy) error {
+	if by.Bucket {
+		return fmt.Errorf("%w: bucket cannot be ranked, use start_time and end_time to select the time range", errInvalidRanking)
+	}
+	if !by.Host && !by.Level && !by.Logger {
+		return fmt.Errorf("%w: needs at least one of host, level, logger, logger_prefix:<depth>", errInvalidRanking)
+	}
+	return nil
+}
+
+// partitionKey returns the key of the partition (dimensions of within) a group belongs to
+func (within GroupBy) partitionKey(group *GroupedStat) string {
+	partition := &GroupedStat{}
+	if within.Host {
+		partition.HostName = group.HostName
+	}
+	if within.Level {
+		partition.Level = group.Level
+	}
+	if within.Logger {
+		partition.Logger = group.Logger
+	}
+	return partition.key()
+}
+
+// QueryTop ranks the groups of the matching buckets by total, rate or share, the top Limit entries of
+// each partition are returned (partitions with the highest total first)
+func (s *LogStatStore) QueryTop(filter QueryFilter, q TopQuery) ([]*TopEntry, error) {
+	if err := validateRankingGroups(q.By); err != nil {
+		return nil, err
+	}
+	if q.Within.Bucket ||
+		(q.Within.Host && !q.By.Host) || (q.Within.Level && !q.By.Level) ||
+		(q.Within.Logger && (!q.By.Logger || q.Within.LoggerDepth != q.By.LoggerDepth)) {
+		return nil, fmt.Errorf("%w: within must be a subset of the ranked dimensions", errInvalidRanking)
+	}
+	switch q.RankBy {
+	case "", "total", "rate", "share":
+	default:
+		return nil, fmt.Errorf("%w: rank %q (allowed: total, rate, share)", errInvalidRanking, q.RankBy)
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultRankingLimit
+	}
+
+	groups, _, err := s.queryGroups(filter, q.By)
+	if err != nil {
+		return nil, err
+	}
+
+	// Active duration per group from the buckets of the query resolution
+	bucketed := q.By
+	bucketed.Bucket = true
+	bucketGroups, bucketSize, err := s.queryGroups(filter, bucketed)
+	if err != nil {
+		return nil, err
+	}
+	activeBuckets := make(map[string]int)
+	for _, group := range bucketGroups {
+		group.BucketTS = ""
+		activeBuckets[group.key()]++
+	}
+
+	partitions := make(map[string][]*TopEntry)
+	partitionTotals := make(map[string]int)
+	for _, group := range groups {
+		entry := &TopEntry{GroupedStat: *group}
+		if minutes := float64(activeBuckets[group.key()]) * bucketSize.Minutes(); minutes > 0 {
+			entry.Rate = float64(group.TotalCount) / minutes
+		}
+		key := q.Within.partitionKey(group)
+		partitions[key] = append(partitions[key], entry)
+		partitionTotals[key] += group.TotalCount
+	}
+
+	partitionKeys := make([]string, 0, len(partitions))
+	for key, entries := range partitions {
+		partitionKeys = append(partitionKeys, key)
+		for _, entry := range entries {
+			if partitionTotals[key] > 0 {
+				entry.Share = float64(entry.TotalCount) / float64(partitionTotals[key])
+			}
+		}
+	}
+	sort.Slice(partitionKeys, func(i, j int) bool {
+		if partitionTotals[partitionKeys[i]] != partitionTotals[partitionKeys[j]] {
+			return partitionTotals[partitionKeys[i]] > partitionTotals[partitionKeys[j]]
+		}
+		return partitionKeys[i] < partitionKeys[j]
+	})
+
+	results := []*TopEntry{}
+	for _, key := range partitionKeys {
+		entries := partitions[key]
+		// Share orders like total within a partition
+		sort.Slice(entries, func(i, j int) bool {
+			if q.RankBy == "rate" && entries[i].Rate != entries[j].Rate {
+				return entries[i].Rate > entries[j].Rate
+			}
+			if entries[i].TotalCount != entries[j].TotalCount {
+				return entries[i].TotalCount > entries[j].TotalCount
+			}
+			return entries[i].key() < entries[j].key()
+		})
+		if len(entries) > q.Limit {
+			entries = entries[:q.Limit]
+		}
+		for i, entry := range entries {
+			entry.Rank = i + 1
+		}
+		results = append(results, entries...)
+	}
+
+	return results, nil
+}
+
+// QueryMovers compares the groups of the current window (filter start and end time, the last hour by
+// default) with the same window Offset earlier and returns the groups that changed most
+func (s *LogStatStore) QueryMovers(filter QueryFilter, q MoversQuery) (*MoversResult, error) {
+	if err := validateRankingGroups(q.By); err != nil {
+		return nil, err
+	}
+	switch q.SortBy {
+	case "", "absolute", "relative":
+	default:
+		return nil, fmt.Errorf("%w: sort %q (allowed: absolute, relative)", errInvalidRanking, q.SortBy)
+	}
+	switch q.Direction {
+	case "", "both", "up", "down":
+	default:
+		return nil, fmt.Errorf("%w: direction %q (allowed: up, down, both)", errInvalidRanking, q.Direction)
+	}
+	if q.Offset <= 0 {
+		q.Offset = defaultMoversOffset
+	}
+	if q.MinVolume <= 0 {
+		q.MinVolume = defaultMinVolume
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultRankingLimit
+	}
+
+	current := filter
+	if current.EndTime.IsZero() {
+		current.EndTime = time.Now()
+	}
+	if current.StartTime.IsZero() {
+		current.StartTime = current.EndTime.Add(-defaultMoversWindow)
+	}
+	if !current.StartTime.Before(current.EndTime) {
+		return nil, fmt.Errorf("%w: start_time must be before end_time", errInvalidRanking)
+	}
+	baseline := current
+	baseline.StartTime = current.StartTime.Add(-q.Offset)
+	baseline.EndTime = current.EndTime.Add(-q.Offset)
+
+	// Both windows at the resolution of the older one, so they are bucketed alike
+	res, err := s.pickResolution(baseline)
+	if err != nil {
+		return nil, err
+	}
+	current.Resolution = res.name()
+	baseline.Resolution = res.name()
+
+	currentGroups, _, err := s.queryGroups(current, q.By)
+	if err != nil {
+		return nil, err
+	}
+	baselineGroups, _, err := s.queryGroups(baseline, q.By)
+	if err != nil {
+		return nil, err
+	}
+
+	movers := make(map[string]*Mover)
+	moverOf := func(group *GroupedStat) *Mover {
+		mover, exists := movers[group.key()]
+		if !exists {
+			mover = &Mover{HostName: group.HostName, Level: group.Level, Logger: group.Logger}
+			movers[group.key()] = mover
+		}
+		return mover
+	}
+	for _, group := range currentGroups {
+		moverOf(group).Current += group.TotalCount
+	}
+	for _, group := range baselineGroups {
+		moverOf(group).Baseline += group.TotalCount
+	}
+
+	result := &MoversResult{
+		CurrentStart:  current.StartTime.Format(time.RFC3339),
+		CurrentEnd:    current.EndTime.Format(time.RFC3339),
+		BaselineStart: baseline.StartTime.Format(time.RFC3339),
+		BaselineEnd:   baseline.EndTime.Format(time.RFC3339),
+		Movers:        []*Mover{},
+	}
+	for _, mover := range movers {
+		if mover.Current < q.MinVolume && mover.Baseline < q.MinVolume {
+			continue
+		}
+		mover.Change = mover.Current - mover.Baseline
+		if mover.Change == 0 || (q.Direction == "up" && mover.Change < 0) || (q.Direction == "down" && mover.Change > 0) {
+			continue
+		}
+		if mover.Baseline > 0 {
+			relative := float64(mover.Change) / float64(mover.Baseline)
+			mover.RelativeChange = &relative
+		}
+		result.Movers = append(result.Movers, mover)
+	}
+
+	// New groups have an infinite relative change
+	relativeChange := func(mover *Mover) float64 {
+		if mover.RelativeChange == nil {
+			return math.Inf(1)
+		}
+		return math.Abs(*mover.RelativeChange)
+	}
+	sort.Slice(result.Movers, func(i, j int) bool {
+		a, b := result.Movers[i], result.Movers[j]
+		if q.SortBy == "relative" && relativeChange(a) != relativeChange(b) {
+			return relativeChange(a) > relativeChange(b)
+		}
+		if abs(a.Change) != abs(b.Change) {
+			return abs(a.Change) > abs(b.Change)
+		}
+		return a.HostName+":"+a.Level+":"+a.Logger < b.HostName+":"+b.Level+":"+b.Logger
+	})
+	if len(result.Movers) > q.Limit {
+		result.Movers = result.Movers[:q.Limit]
+	}
+
+	return result, nil
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -388,6 +388,8 @@ function saveFilterSettings() {
         messageContains: document.getElementById('message-contains').value,
         messageExcludes: document.getElementById('message-excludes').value,
         messageRegex: document.getElementById('message-regex').value,
+        threadPatterns: document.getElementById('thread-patterns').value,
+        mdcMatch: document.getElementById('mdc-match').value,
         stackTraceMode: document.getElementById('stack-trace-mode').value,
         stackInclude: document.getElementById('stack-include').value,
         stackExclude: document.getElementById('stack-exclude').value,
@@ -428,6 +430,8 @@ function loadFilterSettings() {
         if (settings.messageContains !== undefined) document.getElementById('message-contains').value = settings.messageContains;
         if (settings.messageExcludes !== undefined) document.getElementById('message-excludes').value = settings.messageExcludes;
         if (settings.messageRegex !== undefined) document.getElementById('message-regex').value = settings.messageRegex;
+        if (settings.threadPatterns !== undefined) document.getElementById('thread-patterns').value = settings.threadPatterns;
+        if (settings.mdcMatch !== undefined) document.getElementById('mdc-match').value = settings.mdcMatch;
         if (settings.stackTraceMode !== undefined) document.getElementById('stack-trace-mode').value = settings.stackTraceMode;
         if (settings.stackInclude !== undefined) document.getElementById('stack-include').value = settings.stackInclude;
         if (settings.stackExclude !== undefined) document.getElementById('stack-exclude').value = settings.stackExclude;
@@ -673,6 +677,21 @@ function applyFilters() {
     
     const messageRegex = document.getElementById('message-regex').value.trim();
     
+    const threadPatterns = document.getElementById('thread-patterns').value
+        .split('\n')
+        .map(s => s.trim())
+        .filter(s => s.length > 0);
+    
+    const mdcMatch = {};
+    document.getElementById('mdc-match').value
+        .split('\n')
+        .map(s => s.trim())
+        .filter(s => s.includes('='))
+        .forEach(s => {
+            const idx = s.indexOf('=');
+            mdcMatch[s.substring(0, idx).trim()] = s.substring(idx + 1).trim();
+        });
+    
     const stackTraceMode = document.getElementById('stack-trace-mode').value;
     
     const stackInclude = document.getElementById('stack-include').value
@@ -695,6 +714,8 @@ function applyFilters() {
         message_contains: messageContains.length > 0 ? messageContains : undefined,
         message_excludes: messageExcludes.length > 0 ? messageExcludes : undefined,
         message_regex: messageRegex || undefined,
+        thread_patterns: threadPatterns.length > 0 ? threadPatterns : undefined,
+        mdc_match: Object.keys(mdcMatch).length > 0 ? mdcMatch : undefined,
         stack_trace_mode: stackTraceMode,
         stack_trace_include: stackInclude.length > 0 ? stackInclude : undefined,
         stack_trace_exclude: stackExclude.length > 0 ? stackExclude : undefined,
@@ -767,8 +788,18 @@ function showMessageDetails(index) {
     let content = `Timestamp: ${msg.timestamp}\n`;
     content += `Host: ${msg.host}\n`;
     content += `Logger: ${msg.logger}\n`;
-    content += `Level: ${msg.level}\n\n`;
-    content += `Message:\n${msg.message}\n`;
+    content += `Level: ${msg.level}\n`;
+    if (msg.thread_name) content += `Thread: ${msg.thread_name}${msg.thread_id ? ' (' + msg.thread_id + ')' : ''}\n`;
+    if (msg.sequence) content += `Sequence: ${msg.sequence}\n`;
+    if (msg.logger_class_name) content += `Logger Class: ${msg.logger_class_name}\n`;
+    if (msg.ndc) content += `NDC: ${msg.ndc}\n`;
+    if (msg.mdc) {
+        content += `MDC:\n`;
+        Object.keys(msg.mdc).sort().forEach(key => {
+            content += `  ${key}=${msg.mdc[key]}\n`;
+        });
+    }
+    content += `\nMessage:\n${msg.message}\n`;
     
     if (msg.stack_trace) {
         content += `\n${'='.repeat(60)}\nStack Trace:\n${'='.repeat(60)}\n`;
@@ -23,6 +23,10 @@ type ClientSubscription struct {
 	MessageExcludes []string `json:"message_excludes"` // e.g., ["debug info"]
 	MessageRegex    string   `json:"message_regex"`    // Optional regex
 
+	// Context filtering (WildFly json-formatter extras)
+	ThreadPatterns []string          `json:"thread_patterns"` // e.g., ["default task-*", "EJB default - *"]
+	MDCMatch       map[string]string `json:"mdc_match"`       // e.g., {"requestId": "abc-123", "tenant": "acme*"}
+
 	// Stack trace control
 	StackTraceMode    string   `json:"stack_trace_mode"`    // "summary", "filtered"
 	StackTraceInclude []string `json:"stack_trace_include"` // Package patterns to include
@@ -42,6 +46,8 @@ type MessageFilter struct {
 	// Compiled patterns for performance
 	hostGlobs    []glob.Glob
 	loggerGlobs  []glob.Glob
+	threadGlobs  []glob.Glob
+	mdcGlobs     map[string]glob.Glob
 	messageRegex *regexp.Regexp
 	stackInclude []glob.Glob
 	stackExclude []glob.Glob
@@ -71,6 +77,27 @@ func NewMessageFilter(sub *ClientSubscription) (*MessageFilter, error) {
 		filter.loggerGlobs = append(filter.loggerGlobs, g)
 	}
 
+	// Compile thread patterns
+	for _, pattern := range sub.ThreadPatterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.threadGlobs = append(filter.threadGlobs, g)
+	}
+
+	// Compile MDC value patterns
+	if len(sub.MDCMatch) > 0 {
+		filter.mdcGlobs = make(map[string]glob.Glob, len(sub.MDCMatch))
+		for key, pattern := range sub.MDCMatch {
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			filter.mdcGlobs[key] = g
+		}
+	}
+
 	// Compile message regex if provided
 	if sub.MessageRegex != "" {
 		re, err := regexp.Compile(sub.MessageRegex)
@@ -145,6 +172,28 @@ func (f *MessageFilter) Matches(msg *RawLogEntry) bool {
 		}
 	}
 
+	// Thread filtering
+	if len(f.threadGlobs) > 0 {
+		matched := false
+		for _, g := range f.threadGlobs {
+			if g.Match(msg.ThreadName) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	// MDC filtering (all keys must match)
+	for key, g := range f.mdcGlobs {
+		value, exists := msg.MDC[key]
+		if !exists || !g.Match(value) {
+			return false
+		}
+	}
+
 	// Message contains filtering
 	if len(f.subscription.MessageContains) > 0 {
 		matched := false
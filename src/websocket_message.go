@@ -16,6 +16,19 @@ type LogMessage struct {
 	Level      string      `json:"level"`
 	Message    string      `json:"message"`
 	StackTrace interface{} `json:"stack_trace,omitempty"` // Can be StackTraceSummary or StackTraceFiltered
+
+	// WildFly json-formatter extras
+	ThreadName      string            `json:"thread_name,omitempty"`
+	ThreadID        int64             `json:"thread_id,omitempty"`
+	Sequence        int64             `json:"sequence,omitempty"`
+	LoggerClassName string            `json:"logger_class_name,omitempty"`
+	NDC             string            `json:"ndc,omitempty"`
+	MDC             map[string]string `json:"mdc,omitempty"`
+
+	Labels    map[string]string `json:"labels,omitempty"`     // labels added by ingest rules
+	PatternID string            `json:"pattern_id,omitempty"` // mined message pattern (if pattern mining is enabled)
+
+	StackFingerprint string `json:"stack_fingerprint,omitempty"` // normalized stack trace fingerprint
 }
 
 // StackTraceSummary provides minimal stack trace info for low bandwidth
@@ -72,6 +85,41 @@ type RawLogEntry struct {
 	Level      string
 	Message    string
 	StackTrace string // Single string field as specified
+
+	// Optional context (WildFly json-formatter extras)
+	ThreadName      string
+	ThreadID        int64
+	Sequence        int64
+	LoggerClassName string
+	NDC             string
+	MDC             map[string]string
+
+	Labels    map[string]string // labels added by ingest rules
+	PatternID string            // mined message pattern (set during ingest if pattern mining is enabled)
+
+	StackFingerprint string // normalized stack trace fingerprint (set during ingest)
+}
+
+// DimensionValue returns the value of a context field that can be promoted to an aggregation
+// dimension: "thread", "ndc", "loggerClassName", "mdc.<key>" or "label.<key>"
+func (raw *RawLogEntry) DimensionValue(name string) (string, bool) {
+	switch name {
+	case "thread":
+		return raw.ThreadName, raw.ThreadName != ""
+	case "ndc":
+		return raw.NDC, raw.NDC != ""
+	case "loggerClassName":
+		return raw.LoggerClassName, raw.LoggerClassName != ""
+	}
+	if key, ok := strings.CutPrefix(name, "mdc."); ok {
+		value, exists := raw.MDC[key]
+		return value, exists && value != ""
+	}
+	if key, ok := strings.CutPrefix(name, "label."); ok {
+		value, exists := raw.Labels[key]
+		return value, exists && value != ""
+	}
+	return "", false
 }
 
 // TransformMessage converts a raw log entry to a WebSocket message with filtered stack trace
@@ -82,6 +130,18 @@ func TransformMessage(raw *RawLogEntry, filter *MessageFilter) *LogMessage {
 		Logger:    raw.Logger,
 		Level:     raw.Level,
 		Message:   raw.Message,
+
+		ThreadName:      raw.ThreadName,
+		ThreadID:        raw.ThreadID,
+		Sequence:        raw.Sequence,
+		LoggerClassName: raw.LoggerClassName,
+		NDC:             raw.NDC,
+		MDC:             raw.MDC,
+
+		Labels:    raw.Labels,
+		PatternID: raw.PatternID,
+
+		StackFingerprint: raw.StackFingerprint,
 	}
 
 	// Process stack trace based on mode